@@ -0,0 +1,199 @@
+package pokervision
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// MatcherBuilder builds a matcher in code, as an alternative to loading it
+// from a ref file. Sources and references added later replace earlier ones of
+// the same name. The methods return the builder to allow chaining.
+type MatcherBuilder struct {
+	m   matcher
+	err error
+}
+
+// NewMatcherBuilder creates an empty matcher builder.
+func NewMatcherBuilder() *MatcherBuilder {
+	return new(MatcherBuilder)
+}
+
+// AddSource adds a source described by 2 ints (pixel) or 4 ints (x, y, width
+// and height of a region), compared against the named references.
+func (b *MatcherBuilder) AddSource(name string, src []int,
+	refs ...string) *MatcherBuilder {
+
+	b.m.merge(&matcher{Srcs: []source{{Name: name,
+		Src: append([]int(nil), src...), Refs: append([]string(nil), refs...)}}})
+	return b
+}
+
+// AddPixel adds a source sampling a single pixel.
+func (b *MatcherBuilder) AddPixel(name string, pt image.Point,
+	refs ...string) *MatcherBuilder {
+	return b.AddSource(name, []int{pt.X, pt.Y}, refs...)
+}
+
+// AddRegion adds a source sampling a rectangular region.
+func (b *MatcherBuilder) AddRegion(name string, rect image.Rectangle,
+	refs ...string) *MatcherBuilder {
+	return b.AddSource(name, []int{rect.Min.X, rect.Min.Y, rect.Dx(),
+		rect.Dy()}, refs...)
+}
+
+// AddPoints adds a source sampling a set of pixels.
+func (b *MatcherBuilder) AddPoints(name string, pts []image.Point,
+	refs ...string) *MatcherBuilder {
+
+	points := make([][]int, len(pts))
+	for i, p := range pts {
+		points[i] = []int{p.X, p.Y}
+	}
+
+	b.m.merge(&matcher{Srcs: []source{{Name: name, Points: points,
+		Refs: append([]string(nil), refs...)}}})
+	return b
+}
+
+// AddGrid adds a source sampling the centers of cols x rows cells covering a
+// rectangle.
+func (b *MatcherBuilder) AddGrid(name string, rect image.Rectangle, cols,
+	rows int, refs ...string) *MatcherBuilder {
+
+	b.m.merge(&matcher{Srcs: []source{{Name: name,
+		Grid: []int{rect.Min.X, rect.Min.Y, rect.Dx(), rect.Dy(), cols, rows},
+		Refs: append([]string(nil), refs...)}}})
+	return b
+}
+
+// AddPixels adds a pixel signature reference. The pixels of a source match if
+// at least fraction (0-1, 0 meaning all) of them are within tolerance of the
+// expected colors. A single color is expected for all pixels.
+func (b *MatcherBuilder) AddPixels(name string, colors []color.Color,
+	tolerance int, fraction float64) *MatcherBuilder {
+
+	spec := RefSpec{Kind: RefPixels, Tolerance: tolerance, Fraction: fraction}
+	for _, c := range colors {
+		spec.Colors = append(spec.Colors, string(htmlColor(c)))
+	}
+
+	return b.AddReference(name, spec)
+}
+
+// Classify makes a source added before score all of its references and match
+// the best one, unless its margin to the runner-up is below minMargin (0-1).
+func (b *MatcherBuilder) Classify(name string,
+	minMargin float64) *MatcherBuilder {
+
+	for i := range b.m.Srcs {
+		if b.m.Srcs[i].Name == name {
+			b.m.Srcs[i].Classify = true
+			b.m.Srcs[i].MinMargin = minMargin
+			return b
+		}
+	}
+
+	if b.err == nil {
+		b.err = fmt.Errorf("Source does not exist srcName=%v", name)
+	}
+	return b
+}
+
+// AddReference adds a reference from its structured definition.
+func (b *MatcherBuilder) AddReference(name string,
+	spec RefSpec) *MatcherBuilder {
+
+	b.m.merge(&matcher{Refs: []reference{{Name: name, RefSpec: spec}}})
+	return b
+}
+
+// AddImage adds an image, edge or histogram reference held in memory. spec
+// holds the options of the comparison, its Kind defaults to RefImage and its
+// File is ignored.
+func (b *MatcherBuilder) AddImage(name string, img image.Image,
+	spec RefSpec) *MatcherBuilder {
+
+	if spec.Kind == "" {
+		spec.Kind = RefImage
+	}
+	spec.File = ""
+
+	b.m.merge(&matcher{Refs: []reference{{Name: name, RefSpec: spec,
+		img: img}}})
+	return b
+}
+
+// AddMaskedImage adds an image reference held in memory, which only compares
+// the pixels that are white in mask. mask must have the size of img.
+func (b *MatcherBuilder) AddMaskedImage(name string, img image.Image,
+	mask image.Image, spec RefSpec) *MatcherBuilder {
+
+	if spec.Kind == "" {
+		spec.Kind = RefImage
+	}
+	spec.File = ""
+	spec.Mask = ""
+
+	b.m.merge(&matcher{Refs: []reference{{Name: name, RefSpec: spec,
+		img: img, mask: mask}}})
+	return b
+}
+
+// AddKNN adds a kNN reference classifying regions by the labels of the
+// example images held in memory. The Examples of opts are ignored.
+func (b *MatcherBuilder) AddKNN(name string, examples map[string][]image.Image,
+	opts KNNOptions) *MatcherBuilder {
+
+	opts.Examples = nil
+	spec := RefSpec{Kind: RefKNN, KNN: &opts}
+
+	b.m.merge(&matcher{Refs: []reference{{Name: name, RefSpec: spec,
+		knn: newKNNModel(examples, spec)}}})
+	return b
+}
+
+// AddColor adds a color reference. Color components may differ by up to
+// tolerance (0-255).
+func (b *MatcherBuilder) AddColor(name string, c color.Color,
+	tolerance int) *MatcherBuilder {
+
+	return b.AddReference(name, RefSpec{
+		Kind:      RefColor,
+		Color:     string(htmlColor(c)),
+		Tolerance: tolerance,
+	})
+}
+
+// AddOCR adds an OCR reference.
+func (b *MatcherBuilder) AddOCR(name string, opts OCROptions) *MatcherBuilder {
+	return b.AddReference(name, RefSpec{Kind: RefOCR, OCR: &opts})
+}
+
+// Build validates the sources and references and creates the matcher. The
+// builder may be used further without affecting the created matcher.
+func (b *MatcherBuilder) Build() (Matcher, error) {
+
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	for i := range b.m.Srcs {
+		if err := b.m.Srcs[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range b.m.Refs {
+		if _, err := b.m.Refs[i].spec(); err != nil {
+			return nil, fmt.Errorf("%v refName=%v", err, b.m.Refs[i].Name)
+		}
+	}
+
+	m := &matcher{
+		Srcs: append([]source(nil), b.m.Srcs...),
+		Refs: append([]reference(nil), b.m.Refs...),
+	}
+
+	return m, nil
+}
@@ -0,0 +1,91 @@
+package pokervision
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestMatcherBuilder_Build(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("MatcherBuilder.Build() failed to load master image. %v", err)
+	}
+	redVal, err := loadImage("./testdata/redVal.png")
+	if err != nil {
+		t.Errorf("MatcherBuilder.Build() failed to load test files. %v", err)
+	}
+	blackVal, err := loadImage("./testdata/blackVal.png")
+	if err != nil {
+		t.Errorf("MatcherBuilder.Build() failed to load test files. %v", err)
+	}
+
+	b := NewMatcherBuilder().
+		AddRegion("srcImg1", image.Rect(22, 35, 30, 47), "refImg1", "refImg2").
+		AddRegion("srcMImg1", image.Rect(46, 27, 54, 39), "refMImg1").
+		AddPixel("srcColor1", image.Pt(9, 28), "refColor1", "refColor2").
+		AddSource("srcColor2", []int{80, 42}, "refColor1", "refColor2").
+		AddImage("refImg1", redVal, RefSpec{}).
+		AddImage("refImg2", blackVal, RefSpec{}).
+		AddImage("refMImg1", redVal, RefSpec{Kind: RefImageM}).
+		AddColor("refColor1", color.RGBA{0x42, 0x68, 0xf4, 255}, 0).
+		AddColor("refColor2", color.RGBA{0xd7, 0x42, 0xf4, 255}, 0).
+		AddOCR("refOCR", OCROptions{Width: 200})
+
+	m, err := b.Build()
+	if err != nil {
+		t.Fatalf("MatcherBuilder.Build() error = %v", err)
+	}
+
+	tests := []struct {
+		srcName string
+		wantRef string
+	}{
+		{"srcImg1", "refImg2"},
+		{"srcMImg1", "refMImg1"},
+		{"srcColor1", "refColor2"},
+		{"srcColor2", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.srcName, func(t *testing.T) {
+			if got := m.Match(tt.srcName, img); got != tt.wantRef {
+				t.Errorf("matcher.Match() = %v, want %v", got, tt.wantRef)
+			}
+		})
+	}
+
+	// Replacing a reference does not affect the built matcher.
+	b.AddImage("refImg2", redVal, RefSpec{})
+	if got := m.Match("srcImg1", img); got != "refImg2" {
+		t.Errorf("matcher.Match() = %v, want refImg2", got)
+	}
+	m2, err := b.Build()
+	if err != nil {
+		t.Fatalf("MatcherBuilder.Build() error = %v", err)
+	}
+	if got := m2.Match("srcImg1", img); got != "" {
+		t.Errorf("matcher.Match() = %v, want no match", got)
+	}
+}
+
+func TestMatcherBuilder_Build_errors(t *testing.T) {
+
+	tests := []struct {
+		name string
+		b    *MatcherBuilder
+	}{
+		{"Illegal source", NewMatcherBuilder().AddSource("s", []int{1, 2, 3})},
+		{"Invalid reference", NewMatcherBuilder().AddReference("r",
+			RefSpec{Kind: RefColor, Color: "red"})},
+		{"Image without file", NewMatcherBuilder().AddReference("r",
+			RefSpec{Kind: RefImage})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.b.Build(); err == nil {
+				t.Errorf("MatcherBuilder.Build() error = nil, want error")
+			}
+		})
+	}
+}
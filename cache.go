@@ -0,0 +1,140 @@
+package pokervision
+
+import (
+	"image"
+	"sync"
+)
+
+// CachingMatcher is a matcher which remembers the last result of each source
+// and returns it without matching again while the pixels of the source are
+// unchanged.
+type CachingMatcher interface {
+	Matcher
+
+	// Invalidate forgets the cached result of a source.
+	Invalidate(srcName string)
+
+	// InvalidateAll forgets the cached results of all sources.
+	InvalidateAll()
+}
+
+// NewCachingMatcher creates a matcher caching the results of m. The pixels of
+// a source are identified by a SHA-1 hash over every pixel of the region,
+// which costs about as much as comparing the region against a single image
+// reference. If m is reloadable, the cache is dropped when a reload replaces
+// its configuration.
+func NewCachingMatcher(m Matcher) CachingMatcher {
+	return &cachingMatcher{m: m, cache: make(map[string]cachedResult)}
+}
+
+// cachedResult is the result of a source for the pixels with the given hash.
+type cachedResult struct {
+	hash   string
+	result string
+}
+
+// cachingMatcher implements CachingMatcher.
+type cachingMatcher struct {
+	m Matcher
+
+	mu sync.Mutex
+
+	// gen is the generation of the configuration of m the cached results
+	// were matched with.
+	gen   uint64
+	cache map[string]cachedResult
+}
+
+// current returns the matcher whose results are cached.
+func (cm *cachingMatcher) current() *matcher {
+	im, _ := asMatcher(cm.m)
+	return im
+}
+
+// generation returns the generation of the configuration of the wrapped
+// matcher.
+func (cm *cachingMatcher) generation() uint64 {
+	return configGeneration(cm.m)
+}
+
+// Match returns the cached result of a source if its pixels are unchanged,
+// and matches it otherwise.
+func (cm *cachingMatcher) Match(srcName string, img image.Image) string {
+
+	im := cm.current()
+	if im == nil {
+		return cm.m.Match(srcName, img)
+	}
+
+	s := im.findSource(srcName)
+	if s == nil {
+		return cm.m.Match(srcName, img)
+	}
+
+	hash, ok := regionHash(s, img)
+	if !ok {
+		return cm.m.Match(srcName, img)
+	}
+
+	gen := configGeneration(cm.m)
+
+	cm.mu.Lock()
+	if cm.gen != gen {
+		cm.gen = gen
+		cm.cache = make(map[string]cachedResult)
+	}
+	c, ok := cm.cache[srcName]
+	cm.mu.Unlock()
+
+	if ok && c.hash == hash {
+		return c.result
+	}
+
+	result := cm.m.Match(srcName, img)
+
+	cm.mu.Lock()
+	if cm.gen == gen {
+		cm.cache[srcName] = cachedResult{hash: hash, result: result}
+	}
+	cm.mu.Unlock()
+
+	return result
+}
+
+// VisualizeSource visualizes sources of the wrapped matcher.
+func (cm *cachingMatcher) VisualizeSource(img image.Image,
+	srcs []string) image.Image {
+	return cm.m.VisualizeSource(img, srcs)
+}
+
+// Invalidate forgets the cached result of a source.
+func (cm *cachingMatcher) Invalidate(srcName string) {
+	cm.mu.Lock()
+	delete(cm.cache, srcName)
+	cm.mu.Unlock()
+}
+
+// InvalidateAll forgets the cached results of all sources.
+func (cm *cachingMatcher) InvalidateAll() {
+	cm.mu.Lock()
+	cm.cache = make(map[string]cachedResult)
+	cm.mu.Unlock()
+}
+
+// regionHash returns the hash of the pixels of a source. ok is false if the
+// source is illegal.
+func regionHash(s *source, img image.Image) (hash string, ok bool) {
+
+	srcImg, srcColor, isPixel, ok := grabSource(s, img)
+	if !ok {
+		return "", false
+	}
+
+	if isPixel {
+		pixel := image.NewRGBA(image.Rect(0, 0, 1, 1))
+		pixel.Set(0, 0, srcColor)
+		srcImg = pixel
+	}
+
+	return imageHash(srcImg), true
+}
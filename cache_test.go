@@ -0,0 +1,187 @@
+package pokervision
+
+import (
+	"image"
+	"image/draw"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// countingMatcher counts the matches of each source.
+type countingMatcher struct {
+	Matcher
+	calls map[string]int
+}
+
+func (cm *countingMatcher) current() *matcher {
+	im, _ := asMatcher(cm.Matcher)
+	return im
+}
+
+func (cm *countingMatcher) generation() uint64 {
+	return configGeneration(cm.Matcher)
+}
+
+func (cm *countingMatcher) Match(srcName string, img image.Image) string {
+	cm.calls[srcName]++
+	return cm.Matcher.Match(srcName, img)
+}
+
+func TestNewCachingMatcher(t *testing.T) {
+
+	master, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("NewCachingMatcher() failed to load master image. %v", err)
+	}
+
+	// Copy of the master image showing the red value in place of the black
+	// value.
+	b := master.Bounds()
+	swapped := image.NewRGBA(b)
+	draw.Draw(swapped, b, master, b.Min, draw.Src)
+	draw.Draw(swapped, image.Rect(22, 35, 30, 47), master, image.Pt(46, 27),
+		draw.Src)
+
+	// Copy of the master image changed outside the sources used.
+	other := image.NewRGBA(b)
+	draw.Draw(other, b, master, b.Min, draw.Src)
+	draw.Draw(other, image.Rect(0, 0, 5, 5), image.Black, image.Point{},
+		draw.Src)
+
+	m, err := NewMatcher("./testdata/refs.json")
+	if err != nil {
+		t.Fatalf("NewCachingMatcher() failed to load ref file. %v", err)
+	}
+	counting := &countingMatcher{Matcher: m, calls: make(map[string]int)}
+	cm := NewCachingMatcher(counting)
+
+	tests := []struct {
+		name       string
+		srcName    string
+		img        image.Image
+		invalidate string
+		want       string
+		wantCalls  int
+	}{
+		{"First", "srcImg1", master, "", "refImg2", 1},
+		{"Unchanged", "srcImg1", master, "", "refImg2", 1},
+		{"Changed elsewhere", "srcImg1", other, "", "refImg2", 1},
+		{"Other source", "srcImg2", master, "", "", 1},
+		{"Changed", "srcImg1", swapped, "", "refImg1", 2},
+		{"Changed back", "srcImg1", master, "", "refImg2", 3},
+		{"Invalidated", "srcImg1", master, "srcImg1", "refImg2", 4},
+		{"Invalidated other", "srcImg1", master, "srcImg2", "refImg2", 4},
+		{"Pixel", "srcColor1", master, "", "refColor2", 1},
+		{"Pixel unchanged", "srcColor1", other, "", "refColor2", 1},
+		{"Invalid source", "invalidSrc1", master, "", "", 1},
+		{"Invalid source again", "invalidSrc1", master, "", "", 2},
+		{"Missing source", "missing", master, "", "", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.invalidate != "" {
+				cm.Invalidate(tt.invalidate)
+			}
+			if got := cm.Match(tt.srcName, tt.img); got != tt.want {
+				t.Errorf("matcher.Match() = %v, want %v", got, tt.want)
+			}
+			if got := counting.calls[tt.srcName]; got != tt.wantCalls {
+				t.Errorf("matcher.Match() calls = %v, want %v", got,
+					tt.wantCalls)
+			}
+		})
+	}
+
+	cm.InvalidateAll()
+	cm.Match("srcImg1", master)
+	cm.Match("srcColor1", master)
+	if counting.calls["srcImg1"] != 5 || counting.calls["srcColor1"] != 2 {
+		t.Errorf("InvalidateAll() kept cached results calls=%v",
+			counting.calls)
+	}
+}
+
+func TestNewCachingMatcher_reload(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "pokervision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("NewCachingMatcher() failed to load master image. %v", err)
+	}
+
+	writeReloadFixture(t, dir, "", "./testdata/blackVal.png")
+	rm, err := NewReloadableMatcher(filepath.Join(dir, "refs.json"), 0)
+	if err != nil {
+		t.Fatalf("NewReloadableMatcher() error = %v", err)
+	}
+	defer rm.Close()
+
+	cm := NewCachingMatcher(rm)
+	if got := cm.Match("src", img); got != "ref" {
+		t.Errorf("matcher.Match() = %v, want ref", got)
+	}
+
+	writeReloadFixture(t, dir, "", "./testdata/redVal.png")
+	if err := rm.Reload(); err != nil {
+		t.Fatalf("ReloadableMatcher.Reload() error = %v", err)
+	}
+
+	if got := cm.Match("src", img); got != "" {
+		t.Errorf("matcher.Match() after reload = %v, want no match", got)
+	}
+}
+
+func TestNewCachingMatcher_poll(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "pokervision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("NewCachingMatcher() failed to load master image. %v", err)
+	}
+
+	writeReloadFixture(t, dir, "", "./testdata/blackVal.png")
+	rm, err := NewReloadableMatcher(filepath.Join(dir, "refs.json"),
+		5*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewReloadableMatcher() error = %v", err)
+	}
+	defer rm.Close()
+
+	counting := &countingMatcher{Matcher: rm, calls: make(map[string]int)}
+	cm := NewCachingMatcher(counting)
+
+	// Polling an unchanged ref file keeps the cache.
+	for i := 0; i < 5; i++ {
+		if got := cm.Match("src", img); got != "ref" {
+			t.Errorf("matcher.Match() = %v, want ref", got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if counting.calls["src"] != 1 {
+		t.Errorf("matcher.Match() calls = %v, want 1", counting.calls["src"])
+	}
+
+	// A changed reference drops it.
+	writeReloadFixture(t, dir, "", "./testdata/redVal.png")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for cm.Match("src", img) != "" {
+		if time.Now().After(deadline) {
+			t.Fatalf("matcher.Match() did not pick up the changed reference")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,229 @@
+package pokervision
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"image"
+	"image/draw"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// UnknownSample is a region which was not recognized by a matcher.
+type UnknownSample struct {
+
+	// Source is the name of the source.
+	Source string
+
+	// Time is when the region was matched.
+	Time time.Time
+
+	// Image is the region, with origin (0,0). Pixels are captured as images
+	// of a single pixel.
+	Image image.Image `json:"-"`
+
+	// Hash identifies the pixels of the region. Equal regions have equal
+	// hashes.
+	Hash string
+
+	// Result is what Match returned, which is empty unless the region matched
+	// with a low score.
+	Result string
+
+	// Best is the name of the reference which produced Result or, if no
+	// reference matched, of the reference with the highest score.
+	Best string
+
+	// Score is the score of Best.
+	Score float64
+}
+
+// SampleSink receives the regions a matcher did not recognize.
+type SampleSink interface {
+	Capture(sample UnknownSample) error
+}
+
+// NewCapturingMatcher creates a matcher which passes unrecognized regions of
+// the sources of m to sink. A region is unrecognized if Match returns the
+// empty string or, if minScore is positive, if the score of the reference
+// which produced the result is below minScore (0-1). Capturing does not change
+// what Match returns.
+func NewCapturingMatcher(m Matcher, sink SampleSink,
+	minScore float64) Matcher {
+	return &capturingMatcher{m: m, sink: sink, minScore: minScore}
+}
+
+// capturingMatcher implements the matcher returned by NewCapturingMatcher.
+type capturingMatcher struct {
+	m        Matcher
+	sink     SampleSink
+	minScore float64
+}
+
+// current returns the matcher capturing samples.
+func (cm *capturingMatcher) current() *matcher {
+	im, _ := asMatcher(cm.m)
+	return im
+}
+
+// generation returns the generation of the configuration of the wrapped
+// matcher.
+func (cm *capturingMatcher) generation() uint64 {
+	return configGeneration(cm.m)
+}
+
+// Match matches a source with the wrapped matcher and captures the region if
+// it is not recognized. The references of sources of this package's matchers
+// are only scored if nothing matched, to find the closest reference, or if the
+// result must reach a minimum score.
+func (cm *capturingMatcher) Match(srcName string, img image.Image) string {
+
+	result := cm.m.Match(srcName, img)
+	if result != "" && cm.minScore <= 0 {
+		return result
+	}
+
+	im := cm.current()
+	if im == nil {
+		return result
+	}
+
+	s := im.findSource(srcName)
+	if s == nil {
+		return result
+	}
+
+	sample := UnknownSample{Source: srcName, Result: result}
+
+	if result != "" {
+		// Allow for rounding errors.
+		rs, ok := im.matchScore(s, img)
+		if ok && rs.Score >= cm.minScore-1e-9 {
+			return result
+		}
+		sample.Best, sample.Score = rs.Name, rs.Score
+	} else {
+		// Nothing matched, so report the closest reference. The region is
+		// captured without best reference if scoring fails.
+		c, err := im.classify(s, img)
+		if err != nil {
+			log.Printf("error: Failed to score source for capture %v", err)
+		}
+		for i, rs := range c.Scores {
+			if i == 0 || rs.Score > sample.Score {
+				sample.Best, sample.Score = rs.Name, rs.Score
+			}
+		}
+	}
+
+	cm.capture(s, img, sample)
+
+	return result
+}
+
+// capture copies the region of a source from img into the sample and passes
+// it to the sink.
+func (cm *capturingMatcher) capture(s *source, img image.Image,
+	sample UnknownSample) {
+
+	if sample.Image = captureRegion(s, img); sample.Image == nil {
+		return
+	}
+	sample.Time = time.Now()
+	sample.Hash = imageHash(sample.Image)
+
+	if err := cm.sink.Capture(sample); err != nil {
+		log.Printf("error: Failed to capture sample srcName=%v err=%v", s.Name,
+			err)
+	}
+}
+
+// VisualizeSource visualizes sources of the wrapped matcher.
+func (cm *capturingMatcher) VisualizeSource(img image.Image,
+	srcs []string) image.Image {
+	return cm.m.VisualizeSource(img, srcs)
+}
+
+// captureRegion copies the region or pixel described by a source from img. nil
+// is returned if the source is illegal.
+func captureRegion(s *source, img image.Image) image.Image {
+
+	srcImg, srcColor, isPixel, ok := grabSource(s, img)
+	if !ok {
+		return nil
+	}
+
+	if isPixel {
+		out := image.NewRGBA(image.Rect(0, 0, 1, 1))
+		out.Set(0, 0, srcColor)
+		return out
+	}
+
+	b := srcImg.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(out, out.Bounds(), srcImg, b.Min, draw.Src)
+
+	return out
+}
+
+// imageHash returns the hex encoded SHA-1 hash of the size and pixels of an
+// image.
+func imageHash(img image.Image) string {
+
+	h := sha1.New()
+	b := img.Bounds()
+	h.Write([]byte{byte(b.Dx() >> 8), byte(b.Dx()), byte(b.Dy() >> 8),
+		byte(b.Dy())})
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			h.Write([]byte{byte(r >> 8), byte(g >> 8), byte(bl >> 8),
+				byte(a >> 8)})
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// NewDirSink creates a sample sink writing each sample to dir as a PNG file
+// named "<source>-<hash>.png", next to a JSON file with the same name holding
+// the metadata. Samples whose PNG file exists already are skipped, so each
+// region is saved once per source.
+func NewDirSink(dir string) SampleSink {
+	return &dirSink{dir: dir}
+}
+
+// dirSink implements the sink returned by NewDirSink.
+type dirSink struct {
+	dir string
+}
+
+// Capture writes a sample unless it was written before.
+func (ds *dirSink) Capture(sample UnknownSample) error {
+
+	base := filepath.Join(ds.dir, fileName(sample.Source)+"-"+sample.Hash)
+
+	if _, err := os.Stat(base + ".png"); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(ds.dir, 0755); err != nil {
+		return err
+	}
+
+	meta, err := json.MarshalIndent(sample, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(base+".json", append(meta, '\n'),
+		0644); err != nil {
+		return err
+	}
+
+	return writePNG(base+".png", sample.Image)
+}
@@ -0,0 +1,196 @@
+package pokervision
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sliceSink is a sample sink collecting the samples in memory.
+type sliceSink struct {
+	samples []UnknownSample
+}
+
+func (ss *sliceSink) Capture(sample UnknownSample) error {
+	ss.samples = append(ss.samples, sample)
+	return nil
+}
+
+func TestNewCapturingMatcher(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("NewCapturingMatcher() failed to load master image. %v", err)
+	}
+
+	m, err := NewMatcherBuilder().
+		AddPixel("purple", image.Pt(9, 28), "blue", "purple").
+		AddPixel("unknown", image.Pt(9, 28), "blue").
+		AddRegion("val", image.Rect(22, 35, 30, 47), "red").
+		AddRegion("first", image.Rect(22, 35, 30, 47), "loose", "exact").
+		AddColor("blue", color.RGBA{0x42, 0x68, 0xf4, 255}, 0).
+		AddColor("purple", color.RGBA{0xd0, 0x40, 0xf0, 255}, 10).
+		AddReference("red", RefSpec{Kind: RefImage,
+			File: "./testdata/redVal.png"}).
+		AddReference("loose", RefSpec{Kind: RefImage,
+			File: "./testdata/blackValModified.png", Tolerance: 255}).
+		AddReference("exact", RefSpec{Kind: RefImage,
+			File: "./testdata/blackVal.png"}).
+		Build()
+	if err != nil {
+		t.Fatalf("MatcherBuilder.Build() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		minScore  float64
+		srcName   string
+		want      string
+		wantBest  string
+		wantCount int
+	}{
+		{"Match", 0, "purple", "purple", "", 0},
+		{"Low score", 0.99, "purple", "purple", "purple", 1},
+		{"First match", 0.9, "first", "loose", "", 0},
+		{"Low score of first match", 0.99, "first", "loose", "loose", 1},
+		{"No match", 0, "unknown", "", "blue", 1},
+		{"No match region", 0, "val", "", "red", 1},
+		{"Missing source", 0, "missing", "", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := new(sliceSink)
+			cm := NewCapturingMatcher(m, sink, tt.minScore)
+
+			if got := cm.Match(tt.srcName, img); got != tt.want {
+				t.Errorf("matcher.Match() = %v, want %v", got, tt.want)
+			}
+			if len(sink.samples) != tt.wantCount {
+				t.Fatalf("sink samples = %v, want %v", len(sink.samples),
+					tt.wantCount)
+			}
+			if tt.wantCount == 0 {
+				return
+			}
+
+			s := sink.samples[0]
+			if s.Source != tt.srcName || s.Best != tt.wantBest ||
+				s.Result != tt.want || s.Hash == "" || s.Time.IsZero() {
+				t.Errorf("sink sample = %+v", s)
+			}
+		})
+	}
+}
+
+func TestNewCapturingMatcher_wrapped(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("NewCapturingMatcher() failed to load master image. %v", err)
+	}
+
+	m, err := NewMatcherBuilder().
+		AddPixel("purple", image.Pt(9, 28), "purple").
+		AddColor("purple", color.RGBA{0xd7, 0x42, 0xf4, 255}, 0).
+		Build()
+	if err != nil {
+		t.Fatalf("MatcherBuilder.Build() error = %v", err)
+	}
+
+	// The wrapped matcher decides the result, so its cache is used.
+	counting := &countingMatcher{Matcher: m, calls: make(map[string]int)}
+	sink := new(sliceSink)
+	cm := NewCapturingMatcher(NewCachingMatcher(counting), sink, 0)
+
+	for i := 0; i < 2; i++ {
+		if got := cm.Match("purple", img); got != "purple" {
+			t.Errorf("matcher.Match() = %v, want purple", got)
+		}
+	}
+	if counting.calls["purple"] != 1 {
+		t.Errorf("wrapped matcher calls = %v, want 1", counting.calls["purple"])
+	}
+	if len(sink.samples) != 0 {
+		t.Errorf("sink samples = %v, want none", len(sink.samples))
+	}
+}
+
+func TestNewDirSink(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "pokervision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("NewDirSink() failed to load master image. %v", err)
+	}
+
+	m, err := NewMatcherBuilder().
+		AddRegion("seat 1", image.Rect(22, 35, 30, 47)).
+		AddRegion("seat 2", image.Rect(46, 27, 54, 39)).
+		Build()
+	if err != nil {
+		t.Fatalf("MatcherBuilder.Build() error = %v", err)
+	}
+
+	cm := NewCapturingMatcher(m, NewDirSink(dir), 0)
+	for i := 0; i < 2; i++ {
+		cm.Match("seat 1", img)
+		cm.Match("seat 2", img)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.png"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("DirSink files = %v, want 2 PNG files", files)
+	}
+
+	meta, err := ioutil.ReadFile(strings.TrimSuffix(files[0], ".png") + ".json")
+	if err != nil {
+		t.Fatalf("DirSink metadata error = %v", err)
+	}
+	var sample UnknownSample
+	if err := json.Unmarshal(meta, &sample); err != nil {
+		t.Fatalf("DirSink metadata error = %v", err)
+	}
+	if sample.Source != "seat 1" || !strings.Contains(files[0], sample.Hash) {
+		t.Errorf("DirSink metadata = %+v, file %v", sample, files[0])
+	}
+
+	crop, err := loadImage(files[0])
+	if err != nil {
+		t.Fatalf("DirSink image error = %v", err)
+	}
+	if got := imageHash(crop); got != sample.Hash {
+		t.Errorf("imageHash() = %v, want %v", got, sample.Hash)
+	}
+}
+
+func Test_imageHash(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("imageHash() failed to load master image. %v", err)
+	}
+	blackVal, err := loadImage("./testdata/blackVal.png")
+	if err != nil {
+		t.Errorf("imageHash() failed to load test files. %v", err)
+	}
+
+	crop := img.(subImager).SubImage(image.Rect(22, 35, 30, 47))
+	if imageHash(crop) != imageHash(blackVal) {
+		t.Errorf("imageHash() differs for equal images")
+	}
+
+	other := img.(subImager).SubImage(image.Rect(46, 27, 54, 39))
+	if imageHash(other) == imageHash(blackVal) {
+		t.Errorf("imageHash() equal for different images")
+	}
+}
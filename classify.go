@@ -0,0 +1,410 @@
+package pokervision
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+)
+
+// RefScore is the outcome of comparing a source against a single reference.
+type RefScore struct {
+
+	// Name is the name of the reference.
+	Name string
+
+	// Result is what Match returns if the reference is chosen: the value of
+	// the reference, the recognized text of OCR references or the label of
+	// kNN references.
+	Result string
+
+	// Score rates the similarity of source and reference from 0 (nothing in
+	// common) to 1 (identical).
+	Score float64
+
+	// Matched tells if the reference matches on its own, within its
+	// tolerances.
+	Matched bool
+
+	// Text is the unfiltered text recognized by OCR references or the label
+	// predicted by kNN references, whether it is accepted or not.
+	Text string
+}
+
+// Classification is the outcome of scoring a source against all of its
+// references.
+type Classification struct {
+
+	// Best is the matching reference with the highest score. It is the zero
+	// value if no reference matches.
+	Best RefScore
+
+	// RunnerUp is the reference with the second highest score, whether it
+	// matches or not. It is the zero value if the source has a single
+	// reference.
+	RunnerUp RefScore
+
+	// Margin is the difference between the scores of Best and RunnerUp.
+	Margin float64
+
+	// Ambiguous tells if Margin is below the minimum margin of the source.
+	Ambiguous bool
+
+	// Scores lists all references in the order they appear in Refs.
+	Scores []RefScore
+}
+
+// Result returns what Match returns for the classification: the result of the
+// best reference, or the empty string if no reference matches or the
+// classification is ambiguous.
+func (c Classification) Result() string {
+	if c.Ambiguous {
+		return ""
+	}
+	return c.Best.Result
+}
+
+// chosen returns the score of the reference Match returns for a source: the
+// best reference of classifying sources, the first matching reference of
+// others. ok is false if Match returns no reference.
+func (c Classification) chosen(s *source) (rs RefScore, ok bool) {
+
+	if s.Classify {
+		return c.Best, c.Best.Matched && !c.Ambiguous
+	}
+
+	for _, rs := range c.Scores {
+		if rs.Matched {
+			return rs, true
+		}
+	}
+
+	return RefScore{}, false
+}
+
+// Classify scores the region of img described by a source against all of its
+// references. Unlike Match, which returns the first reference that matches,
+// the best matching reference is chosen and compared with the runner-up.
+func Classify(m Matcher, srcName string, img image.Image) (Classification,
+	error) {
+
+	im, ok := asMatcher(m)
+	if !ok {
+		return Classification{}, errors.New("Unsupported matcher type")
+	}
+
+	// Locate source.
+	s := im.findSource(srcName)
+	if s == nil {
+		return Classification{}, fmt.Errorf(
+			"Source does not exist srcName=%v", srcName)
+	}
+
+	return im.classify(s, img)
+}
+
+// classify scores a source against all of its references.
+func (im *matcher) classify(s *source, img image.Image) (Classification,
+	error) {
+
+	srcImg, srcColor, isPixel, ok := grabSource(s, img)
+	if !ok {
+		return Classification{}, fmt.Errorf("Illegal source srcName=%v",
+			s.Name)
+	}
+
+	var scores []RefScore
+	for _, r := range im.candidates(s) {
+		rs, err := scoreReference(&r, srcImg, srcColor, isPixel)
+		if err != nil {
+			return Classification{}, fmt.Errorf("%v srcName=%v refName=%v",
+				err, s.Name, r.Name)
+		}
+		scores = append(scores, rs)
+	}
+
+	return classifyScores(s, scores), nil
+}
+
+// classifyScores picks the best matching reference of a source and its
+// runner-up among the scores of all references.
+func classifyScores(s *source, scores []RefScore) Classification {
+
+	c := Classification{Scores: scores}
+
+	// Pick the best matching reference. Earlier references win ties.
+	best := -1
+	for i, rs := range c.Scores {
+		if rs.Matched && (best < 0 || rs.Score > c.Scores[best].Score) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return c
+	}
+	c.Best = c.Scores[best]
+
+	// Pick the runner-up among all other references.
+	runnerUp := -1
+	for i, rs := range c.Scores {
+		if i != best && (runnerUp < 0 || rs.Score > c.Scores[runnerUp].Score) {
+			runnerUp = i
+		}
+	}
+	if runnerUp < 0 {
+		c.Margin = c.Best.Score
+	} else {
+		c.RunnerUp = c.Scores[runnerUp]
+		c.Margin = c.Best.Score - c.RunnerUp.Score
+	}
+
+	// Allow for rounding errors.
+	c.Ambiguous = c.Margin < s.MinMargin-1e-9
+
+	return c
+}
+
+// matchBest matches a source in classification mode.
+func (im *matcher) matchBest(s *source, img image.Image) string {
+
+	c, err := im.classify(s, img)
+	if err != nil {
+		log.Printf("error: %v", err)
+		return ""
+	}
+
+	if c.Ambiguous {
+		log.Printf(`warning: Ambiguous match srcName=%v best=%v runnerUp=%v
+			margin=%v`, s.Name, c.Best.Name, c.RunnerUp.Name, c.Margin)
+	}
+
+	return c.Result()
+}
+
+// matchScore scores the references of a source like Match does and returns the
+// score of the reference Match chooses. Unless the source is classifying, its
+// references are scored in order up to the first one which matches. ok is
+// false if Match returns no reference.
+func (im *matcher) matchScore(s *source, img image.Image) (rs RefScore,
+	ok bool) {
+
+	if s.Classify {
+		c, err := im.classify(s, img)
+		if err != nil {
+			return RefScore{}, false
+		}
+		return c.chosen(s)
+	}
+
+	srcImg, srcColor, isPixel, ok := grabSource(s, img)
+	if !ok {
+		return RefScore{}, false
+	}
+
+	for _, r := range im.candidates(s) {
+		if stopsMatch(&r, isPixel) {
+			return RefScore{}, false
+		}
+
+		rs, err := scoreReference(&r, srcImg, srcColor, isPixel)
+		if err == nil && rs.Matched {
+			return rs, true
+		}
+	}
+
+	return RefScore{}, false
+}
+
+// scoreReference compares a source against a single reference. Whether the
+// reference matches is decided exactly like in Match.
+func scoreReference(r *reference, srcImg image.Image, srcColor color.Color,
+	isPixel bool) (RefScore, error) {
+
+	rs := RefScore{Name: r.Name}
+
+	spec, err := r.spec()
+	if err != nil {
+		return rs, err
+	}
+	if err := incompatible(spec.Kind, isPixel); err != nil {
+		return rs, err
+	}
+
+	switch spec.Kind {
+
+	// Color.
+	case RefColor:
+		c, _ := parseHTMLColor(spec.Color)
+		delta := colorDelta(srcColor, c)
+		rs.Score = 1 - float64(delta)/255
+		rs.Matched = delta <= uint32(spec.Tolerance)
+
+	// OCR scores 1 if any text is recognized.
+	case RefOCR:
+		rs.Text = ocrRaw(prepareOCR(preprocess(srcImg, spec.Preprocess),
+			spec.OCR))
+		rs.Result = filterText(rs.Text, spec.OCR)
+		if rs.Result != "" {
+			rs.Score, rs.Matched = 1, true
+		}
+		return rs, nil
+
+	// Image (monochrome or not).
+	case RefImage, RefImageM:
+		if rs.Score, rs.Matched, err = scoreImage(r, spec, srcImg); err != nil {
+			return rs, err
+		}
+
+	// Edges score the fraction of agreeing edge pixels.
+	case RefEdges:
+		refImg, err := r.loadImage(spec.File)
+		if err != nil {
+			return rs, err
+		}
+
+		_, difference, err := compareEdges(preprocess(refImg, spec.Preprocess),
+			preprocess(srcImg, spec.Preprocess), spec.Edges)
+		if err == nil {
+			rs.Score = 1 - difference
+			rs.Matched = edgesMatch(spec, difference)
+		}
+
+	// kNN references score their confidence.
+	case RefKNN:
+		label, confidence, err := classifyKNN(r, srcImg)
+		if err != nil {
+			return rs, err
+		}
+
+		rs.Score, rs.Text = confidence, label
+		if knnConfident(spec, confidence) {
+			rs.Result, rs.Matched = label, true
+		}
+		return rs, nil
+
+	// Histograms score one minus their distance.
+	case RefHistogram, RefDominant:
+		match, distance, err := compareHistogram(r, spec, srcImg)
+		if err != nil {
+			return rs, err
+		}
+
+		rs.Score = 1 - distance
+		if spec.Kind == RefDominant {
+			rs.Score = 1 - distance/255
+		}
+		rs.Matched = match
+
+	// Pixel signatures score the fraction of agreeing pixels.
+	case RefPixels:
+		srcColors := []color.Color{srcColor}
+		if !isPixel {
+			srcColors = imageColors(srcImg)
+		}
+
+		agree, err := comparePixels(spec, srcColors)
+		if err != nil {
+			return rs, err
+		}
+
+		rs.Score = float64(agree) / float64(len(srcColors))
+		rs.Matched = pixelsMatch(spec, agree, len(srcColors))
+	}
+
+	// OCR and kNN references return what they recognized, all others their
+	// value.
+	if rs.Matched {
+		rs.Result = r.result()
+	}
+
+	return rs, nil
+}
+
+// incompatible returns an error if references of a kind cannot be compared
+// against a pixel or an image source.
+func incompatible(kind RefKind, isPixel bool) error {
+
+	switch {
+	case kind == RefColor && !isPixel:
+		return errors.New("Cannot compare image against color")
+	case kind == RefOCR && isPixel:
+		return errors.New("Cannot do OCR on pixel")
+	case (kind == RefImage || kind == RefImageM) && isPixel:
+		return errors.New("Cannot compare pixel against image")
+	case kind == RefEdges && isPixel:
+		return errors.New("Cannot compare pixel against edges")
+	case kind == RefKNN && isPixel:
+		return errors.New("Cannot classify pixel")
+	case (kind == RefHistogram || kind == RefDominant) && isPixel:
+		return errors.New("Cannot compare pixel against histogram")
+	}
+
+	return nil
+}
+
+// stopsMatch tells if Match gives up at a reference, because it is illegal or
+// cannot be compared against the source.
+func stopsMatch(r *reference, isPixel bool) bool {
+	spec, err := r.spec()
+	return err != nil || incompatible(spec.Kind, isPixel) != nil
+}
+
+// scoreImage rates the similarity of an image reference and the source
+// region and tells if they match like in Match. Monochrome references score
+// the fraction of compared pixels which agree, other references one minus the
+// mean of the largest difference of a color component of each compared pixel.
+// The tolerance is ignored for the score. Images of different size score 0,
+// fully masked references 1.
+func scoreImage(r *reference, spec RefSpec, srcImg image.Image) (score float64,
+	matched bool, err error) {
+
+	refImg, err := r.loadImage(spec.File)
+	if err != nil {
+		return 0, false, err
+	}
+
+	mask, err := r.loadMask(spec, refImg)
+	if err != nil {
+		return 0, false, err
+	}
+
+	diff, stats, err := diffSpec(preprocess(refImg, spec.Preprocess),
+		preprocess(srcImg, spec.Preprocess), mask, spec)
+	if err != nil {
+		return 0, false, nil
+	}
+
+	// Like in Match, a fully masked reference matches any image of its size.
+	if stats.Total == 0 {
+		return 1, true, nil
+	}
+
+	if spec.Kind == RefImageM {
+		return float64(stats.Total-stats.Differing) / float64(stats.Total),
+			stats.Equal(), nil
+	}
+
+	// Pixels outside the mask are black in the diff.
+	var sum float64
+	b := diff.Bounds()
+	for x := b.Min.X; x < b.Max.X; x++ {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			dr, dg, db, _ := diff.At(x, y).RGBA()
+			sum += float64(maxUint32(dr, maxUint32(dg, db))) / 65535
+		}
+	}
+
+	return 1 - sum/float64(stats.Total), stats.Equal(), nil
+}
+
+// colorDelta returns the largest difference (0-255) of a color component of
+// two colors.
+func colorDelta(c1 color.Color, c2 color.Color) uint32 {
+
+	r1, g1, b1, _ := c1.RGBA()
+	r2, g2, b2, _ := c2.RGBA()
+
+	return maxUint32(absDiff(r1/256, r2/256),
+		maxUint32(absDiff(g1/256, g2/256), absDiff(b1/256, b2/256)))
+}
@@ -0,0 +1,135 @@
+package pokervision
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("Classify() failed to load master image. %v", err)
+	}
+
+	m, err := NewMatcher("./testdata/classify.json")
+	if err != nil {
+		t.Fatalf("Classify() failed to load ref file. %v", err)
+	}
+
+	tests := []struct {
+		srcName       string
+		wantMatch     string
+		wantBest      string
+		wantRunnerUp  string
+		wantAmbiguous bool
+	}{
+		{"srcFirst", "refLoose", "refExact", "refLoose", false},
+		{"srcBest", "refExact", "refExact", "refLoose", false},
+		{"srcAmbiguous", "", "refExact", "refLoose", true},
+		{"srcColor", "refPurple", "refPurple", "refPink", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.srcName, func(t *testing.T) {
+			if got := m.Match(tt.srcName, img); got != tt.wantMatch {
+				t.Errorf("matcher.Match() = %v, want %v", got, tt.wantMatch)
+			}
+
+			c, err := Classify(m, tt.srcName, img)
+			if err != nil {
+				t.Fatalf("Classify() error = %v", err)
+			}
+			if c.Best.Name != tt.wantBest || c.RunnerUp.Name != tt.wantRunnerUp {
+				t.Errorf("Classify() best = %v, runner-up = %v, want %v, %v",
+					c.Best.Name, c.RunnerUp.Name, tt.wantBest, tt.wantRunnerUp)
+			}
+			if c.Ambiguous != tt.wantAmbiguous {
+				t.Errorf("Classify() ambiguous = %v, want %v", c.Ambiguous,
+					tt.wantAmbiguous)
+			}
+			if want := c.Best.Score - c.RunnerUp.Score; math.Abs(c.Margin-want) > 1e-9 {
+				t.Errorf("Classify() margin = %v, want %v", c.Margin, want)
+			}
+		})
+	}
+
+	if _, err := Classify(m, "srcMissing", img); err == nil {
+		t.Errorf("Classify() error = nil, want error")
+	}
+}
+
+func TestClassify_noMatch(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("Classify() failed to load master image. %v", err)
+	}
+
+	m, err := NewMatcherBuilder().
+		AddPixel("src", image.Pt(9, 28), "blue").
+		AddColor("blue", color.RGBA{0x42, 0x68, 0xf4, 255}, 0).
+		Classify("src", 0).
+		Build()
+	if err != nil {
+		t.Fatalf("MatcherBuilder.Build() error = %v", err)
+	}
+
+	c, err := Classify(m, "src", img)
+	if err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	if c.Result() != "" || c.Best.Name != "" || len(c.Scores) != 1 ||
+		c.Scores[0].Matched {
+		t.Errorf("Classify() = %+v, want no match", c)
+	}
+}
+
+func TestMatcherBuilder_Classify(t *testing.T) {
+
+	if _, err := NewMatcherBuilder().Classify("missing", 0).Build(); err == nil {
+		t.Errorf("MatcherBuilder.Build() error = nil, want error")
+	}
+
+	if _, err := NewMatcherBuilder().AddPixel("src", image.Pt(0, 0)).
+		Classify("src", 2).Build(); err == nil {
+		t.Errorf("MatcherBuilder.Build() error = nil, want error")
+	}
+}
+
+func TestClassify_fullyMasked(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("Classify() failed to load master image. %v", err)
+	}
+
+	// A transparent mask leaves no pixels to compare.
+	transparent := image.NewAlpha(image.Rect(0, 0, 8, 12))
+
+	for _, kind := range []RefKind{RefImage, RefImageM} {
+		t.Run(string(kind), func(t *testing.T) {
+			m := &matcher{
+				Srcs: []source{{Name: "src", Src: []int{46, 27, 8, 12},
+					Refs: []string{"ref"}}},
+				Refs: []reference{{Name: "ref",
+					Ref:  string(kind) + ":./testdata/blackVal.png",
+					mask: transparent}},
+			}
+
+			if got := m.Match("src", img); got != "ref" {
+				t.Errorf("matcher.Match() = %v, want ref", got)
+			}
+
+			c, err := Classify(m, "src", img)
+			if err != nil {
+				t.Fatalf("Classify() error = %v", err)
+			}
+			if c.Result() != "ref" || !c.Best.Matched || c.Best.Score != 1 {
+				t.Errorf("Classify() best = %+v, want ref matching with score 1",
+					c.Best)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+// Command pvcorpus runs a matcher against a corpus of labeled screenshots.
+//
+// The sources are read from a ref file, the screenshots and their labels from
+// a JSON encoded sample file or a directory, as used by pvtrain:
+//
+//	{"Samples":[{"File":"shot1.png","Labels":{"seat1.card1":"As"}}]}
+//
+// The accuracy of each source and a confusion matrix of each reference set are
+// printed. If a previous report is given, the outcomes which changed are
+// listed and the command exits with status 1 if any of them regressed.
+//
+// Usage:
+//
+//	pvcorpus -refs refs.json -samples samples.json -prev last.json -out report.json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	pokervision "github.com/whomever000/poker-vision"
+)
+
+func main() {
+
+	refFile := flag.String("refs", "", "ref file with the sources to test")
+	sampleFile := flag.String("samples", "", "JSON file listing labeled screenshots, or directory of screenshots and label files")
+	prevFile := flag.String("prev", "", "report of a previous run to compare against")
+	out := flag.String("out", "", "file to write the report to")
+	confusion := flag.Bool("confusion", true, "print the confusion matrices")
+	flag.Parse()
+
+	if *refFile == "" || *sampleFile == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	m, err := pokervision.NewMatcher(*refFile)
+	if err != nil {
+		fatalf("Failed to load ref file refFile=%v err=%v", *refFile, err)
+	}
+
+	samples, err := pokervision.OpenSamples(*sampleFile)
+	if err != nil {
+		fatalf("Failed to load samples sampleFile=%v err=%v", *sampleFile, err)
+	}
+
+	var prev *pokervision.CorpusReport
+	if *prevFile != "" {
+		if prev, err = pokervision.LoadCorpusReport(*prevFile); err != nil {
+			fatalf("Failed to load report prev=%v err=%v", *prevFile, err)
+		}
+	}
+
+	report, err := pokervision.RunCorpus(m, samples)
+	if err != nil {
+		fatalf("Corpus run failed err=%v", err)
+	}
+
+	printAccuracy(report, prev)
+	if *confusion {
+		for _, cm := range report.Confusion {
+			printConfusion(&cm)
+		}
+	}
+
+	if *out != "" {
+		if err := report.Save(*out); err != nil {
+			fatalf("Failed to save report out=%v err=%v", *out, err)
+		}
+	}
+
+	if prev == nil {
+		return
+	}
+
+	regressions := 0
+	changes := pokervision.DiffCorpus(prev, report)
+	if len(changes) > 0 {
+		fmt.Println()
+	}
+	for _, c := range changes {
+		fmt.Println(c)
+		if c.Regression() {
+			regressions++
+		}
+	}
+	if regressions > 0 {
+		fmt.Fprintf(os.Stderr, "%v regressions\n", regressions)
+		os.Exit(1)
+	}
+}
+
+// printAccuracy prints the accuracy of each source, next to the accuracy of
+// the previous run if any.
+func printAccuracy(report, prev *pokervision.CorpusReport) {
+
+	was := make(map[string]float64)
+	if prev != nil {
+		for _, a := range prev.Sources {
+			was[a.Source] = a.Accuracy()
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tCORRECT\tTOTAL\tACCURACY\tPREVIOUS")
+	for _, a := range report.Sources {
+		previous := "-"
+		if acc, ok := was[a.Source]; ok {
+			previous = fmt.Sprintf("%.1f%%", acc*100)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%.1f%%\t%v\n", a.Source, a.Correct,
+			a.Total, a.Accuracy()*100, previous)
+	}
+	fmt.Fprintf(w, "all\t\t\t%.1f%%\t\n", report.Accuracy()*100)
+	w.Flush()
+}
+
+// printConfusion prints a confusion matrix with a row for each label and a
+// column for each value returned.
+func printConfusion(cm *pokervision.ConfusionMatrix) {
+
+	fmt.Printf("\nsources=%v refs=%v\n", strings.Join(cm.Sources, ","),
+		strings.Join(cm.Refs, ","))
+
+	labels := cm.Labels()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 1, ' ', tabwriter.AlignRight)
+	fmt.Fprint(w, "\t")
+	for _, got := range labels {
+		fmt.Fprintf(w, "%v\t", display(got))
+	}
+	fmt.Fprintln(w)
+
+	for _, want := range labels {
+		row, ok := cm.Counts[want]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "%v\t", display(want))
+		for _, got := range labels {
+			fmt.Fprintf(w, "%v\t", row[got])
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+}
+
+// display returns the printed form of a value.
+func display(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
+
+// fatalf prints an error and exits.
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
+	os.Exit(1)
+}
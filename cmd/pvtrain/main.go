@@ -0,0 +1,96 @@
+// Command pvtrain learns references from labeled screenshots.
+//
+// The sources are read from a ref file, the screenshots and their labels from
+// a JSON encoded sample file:
+//
+//	{"Samples":[{"File":"shot1.png","Labels":{"seat1.card1":"As"}}]}
+//
+// or from a directory of PNG screenshots, each labeled by a JSON encoded file
+// of the same name, e.g. shot1.png and shot1.json holding
+//
+//	{"seat1.card1":"As"}
+//
+// The crops of each labeled source are clustered, a reference image is saved
+// for each cluster and the sources and references are written to a new ref
+// file. Crops which were labeled with different values are reported.
+//
+// Usage:
+//
+//	pvtrain -refs refs.json -samples samples.json -dir refs -out trained.json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	pokervision "github.com/whomever000/poker-vision"
+)
+
+func main() {
+
+	refFile := flag.String("refs", "", "ref file with the sources to train")
+	sampleFile := flag.String("samples", "", "JSON file listing labeled screenshots, or directory of screenshots and label files")
+	dir := flag.String("dir", "refs", "directory the reference images are saved to")
+	out := flag.String("out", "trained.json", "ref file to write")
+	kind := flag.String("kind", "image", "kind of the learned image references (image or imageM)")
+	tolerance := flag.Int("tolerance", 0, "largest difference (0-255) of a color component of equal crops")
+	flag.Parse()
+
+	if *refFile == "" || *sampleFile == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	m, err := pokervision.NewMatcher(*refFile)
+	if err != nil {
+		fatalf("Failed to load ref file refFile=%v err=%v", *refFile, err)
+	}
+
+	samples, err := pokervision.OpenSamples(*sampleFile)
+	if err != nil {
+		fatalf("Failed to open samples sampleFile=%v err=%v", *sampleFile, err)
+	}
+
+	tr, err := pokervision.Train(m, samples, pokervision.TrainOptions{
+		Kind:      pokervision.RefKind(*kind),
+		Tolerance: *tolerance,
+		Dir:       *dir,
+	})
+	if err != nil {
+		fatalf("Training failed err=%v", err)
+	}
+
+	if err := tr.Save(*out, outFormat(*out)); err != nil {
+		fatalf("Failed to save result out=%v err=%v", *out, err)
+	}
+
+	fmt.Printf("Learned %v reference images from %v samples\n", len(tr.Images),
+		tr.Samples)
+
+	for _, c := range tr.Conflicts {
+		fmt.Fprintln(os.Stderr, c)
+	}
+	if len(tr.Conflicts) > 0 {
+		os.Exit(1)
+	}
+}
+
+// outFormat returns the format of a ref file from its extension.
+func outFormat(file string) pokervision.RefFormat {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return pokervision.FormatYAML
+	case ".toml":
+		return pokervision.FormatTOML
+	}
+	return pokervision.FormatJSON
+}
+
+// fatalf prints an error and exits.
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
+	os.Exit(1)
+}
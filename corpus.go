@@ -0,0 +1,293 @@
+package pokervision
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// CorpusOutcome is the result of matching a source of a labeled sample.
+type CorpusOutcome struct {
+	Sample string
+	Source string
+
+	// Want is the label of the source, Got what Match returned.
+	Want string
+	Got  string
+}
+
+// Correct reports whether Match returned the label.
+func (o CorpusOutcome) Correct() bool {
+	return o.Got == o.Want
+}
+
+// SourceAccuracy counts the correctly matched samples of a source.
+type SourceAccuracy struct {
+	Source  string
+	Total   int
+	Correct int
+}
+
+// Accuracy returns the fraction (0-1) of correctly matched samples.
+func (a SourceAccuracy) Accuracy() float64 {
+	if a.Total == 0 {
+		return 0
+	}
+	return float64(a.Correct) / float64(a.Total)
+}
+
+// ConfusionMatrix counts how often the labels of the sources sharing a set of
+// references were matched as each value.
+type ConfusionMatrix struct {
+
+	// Refs is the reference set, in the order the sources list it.
+	Refs []string
+
+	// Sources are the names of the sources referring to the set, sorted.
+	Sources []string
+
+	// Counts maps labels to the values Match returned to their count. The
+	// empty value counts the samples which did not match.
+	Counts map[string]map[string]int
+}
+
+// Labels returns the labels and returned values of the matrix, sorted.
+func (cm *ConfusionMatrix) Labels() []string {
+
+	var labels []string
+	for want, row := range cm.Counts {
+		if !containsString(labels, want) {
+			labels = append(labels, want)
+		}
+		for got := range row {
+			if !containsString(labels, got) {
+				labels = append(labels, got)
+			}
+		}
+	}
+	sort.Strings(labels)
+
+	return labels
+}
+
+// CorpusReport holds the results of matching a corpus of labeled samples.
+type CorpusReport struct {
+
+	// Outcomes lists the result of each labeled source, by sample in order and
+	// by source name within a sample.
+	Outcomes []CorpusOutcome
+
+	// Sources lists the accuracy of each source, sorted by name.
+	Sources []SourceAccuracy
+
+	// Confusion holds a confusion matrix for each reference set, sorted by
+	// the first source referring to it.
+	Confusion []ConfusionMatrix
+}
+
+// Accuracy returns the fraction (0-1) of all labeled sources which were
+// matched correctly.
+func (r *CorpusReport) Accuracy() float64 {
+
+	total := SourceAccuracy{}
+	for _, a := range r.Sources {
+		total.Total += a.Total
+		total.Correct += a.Correct
+	}
+
+	return total.Accuracy()
+}
+
+// RunCorpus matches the labeled sources of all samples and compares the values
+// returned against the labels. Labels of sources m does not have are reported
+// as not matched. Samples are read and matched one at a time, and the run stops
+// at the first error of samples.
+func RunCorpus(m Matcher, samples SampleSource) (*CorpusReport, error) {
+
+	im, ok := asMatcher(m)
+	if !ok {
+		return nil, errors.New("Unsupported matcher type")
+	}
+
+	report := new(CorpusReport)
+	accuracy := make(map[string]*SourceAccuracy)
+	matrices := make(map[string]*ConfusionMatrix)
+
+	for {
+		sample, err := samples.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		srcNames := make([]string, 0, len(sample.Labels))
+		for srcName := range sample.Labels {
+			srcNames = append(srcNames, srcName)
+		}
+		sort.Strings(srcNames)
+
+		for _, srcName := range srcNames {
+			o := CorpusOutcome{
+				Sample: sample.Name,
+				Source: srcName,
+				Want:   sample.Labels[srcName],
+				Got:    m.Match(srcName, sample.Image),
+			}
+			report.Outcomes = append(report.Outcomes, o)
+
+			a := accuracy[srcName]
+			if a == nil {
+				a = &SourceAccuracy{Source: srcName}
+				accuracy[srcName] = a
+			}
+			a.Total++
+			if o.Correct() {
+				a.Correct++
+			}
+
+			var refs []string
+			if s := im.findSource(srcName); s != nil {
+				refs = s.Refs
+			}
+			key := strings.Join(refs, "\n")
+
+			cm := matrices[key]
+			if cm == nil {
+				cm = &ConfusionMatrix{Refs: refs,
+					Counts: make(map[string]map[string]int)}
+				matrices[key] = cm
+			}
+			if !containsString(cm.Sources, srcName) {
+				cm.Sources = append(cm.Sources, srcName)
+			}
+			if cm.Counts[o.Want] == nil {
+				cm.Counts[o.Want] = make(map[string]int)
+			}
+			cm.Counts[o.Want][o.Got]++
+		}
+	}
+
+	for _, a := range accuracy {
+		report.Sources = append(report.Sources, *a)
+	}
+	sort.Slice(report.Sources, func(i, j int) bool {
+		return report.Sources[i].Source < report.Sources[j].Source
+	})
+
+	for _, cm := range matrices {
+		sort.Strings(cm.Sources)
+		report.Confusion = append(report.Confusion, *cm)
+	}
+	sort.Slice(report.Confusion, func(i, j int) bool {
+		return report.Confusion[i].Sources[0] < report.Confusion[j].Sources[0]
+	})
+
+	return report, nil
+}
+
+// Save writes the report to a JSON encoded file, which can be loaded with
+// LoadCorpusReport to compare later runs against it.
+func (r *CorpusReport) Save(file string) error {
+
+	data, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, append(data, '\n'), 0644)
+}
+
+// LoadCorpusReport loads a report written by CorpusReport.Save through the
+// file loader.
+func LoadCorpusReport(file string) (*CorpusReport, error) {
+
+	reader := fileLoader.Load(file)
+	if reader == nil {
+		return nil, errors.New("Failed to load report file")
+	}
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(reader)
+
+	report := new(CorpusReport)
+	if err := json.Unmarshal(buf.Bytes(), report); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// CorpusChange is a labeled source of a sample for which Match returned a
+// different value than in a previous run.
+type CorpusChange struct {
+	Sample string
+	Source string
+	Want   string
+
+	// Was is the value returned by the previous run, Got the current one.
+	Was string
+	Got string
+}
+
+// Regression reports whether the source was matched correctly before, but no
+// longer is.
+func (c CorpusChange) Regression() bool {
+	return c.Was == c.Want && c.Got != c.Want
+}
+
+// Fix reports whether the source is matched correctly now, but was not
+// before.
+func (c CorpusChange) Fix() bool {
+	return c.Was != c.Want && c.Got == c.Want
+}
+
+// String describes the change.
+func (c CorpusChange) String() string {
+
+	kind := "Changed"
+	if c.Regression() {
+		kind = "Regressed"
+	} else if c.Fix() {
+		kind = "Fixed"
+	}
+
+	return fmt.Sprintf("%v sample=%v srcName=%v want=%q was=%q got=%q", kind,
+		c.Sample, c.Source, c.Want, c.Was, c.Got)
+}
+
+// DiffCorpus lists the outcomes of cur which differ from the outcome of the
+// same sample and source in prev, in the order of cur. Outcomes missing from
+// either report are skipped. Samples are identified by name, so names should
+// be unique.
+func DiffCorpus(prev, cur *CorpusReport) []CorpusChange {
+
+	type key struct{ sample, source string }
+	was := make(map[key]string, len(prev.Outcomes))
+	for _, o := range prev.Outcomes {
+		was[key{o.Sample, o.Source}] = o.Got
+	}
+
+	var changes []CorpusChange
+	for _, o := range cur.Outcomes {
+		got, ok := was[key{o.Sample, o.Source}]
+		if !ok || got == o.Got {
+			continue
+		}
+
+		changes = append(changes, CorpusChange{
+			Sample: o.Sample,
+			Source: o.Source,
+			Want:   o.Want,
+			Was:    got,
+			Got:    o.Got,
+		})
+	}
+
+	return changes
+}
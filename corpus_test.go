@@ -0,0 +1,183 @@
+package pokervision
+
+import (
+	"image"
+	"image/draw"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRunCorpus(t *testing.T) {
+
+	master, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("RunCorpus() failed to load master image. %v", err)
+	}
+
+	// Copy of the master image showing the red value in place of the black
+	// value.
+	b := master.Bounds()
+	swapped := image.NewRGBA(b)
+	draw.Draw(swapped, b, master, b.Min, draw.Src)
+	draw.Draw(swapped, image.Rect(22, 35, 30, 47), master, image.Pt(46, 27),
+		draw.Src)
+
+	m, err := NewMatcherBuilder().
+		AddRegion("srcImg", image.Rect(22, 35, 30, 47), "black", "red").
+		AddRegion("srcImg2", image.Rect(46, 27, 54, 39), "black", "red").
+		AddReference("black", RefSpec{Kind: RefImage,
+			File: "./testdata/blackVal.png"}).
+		AddReference("red", RefSpec{Kind: RefImage,
+			File: "./testdata/redVal.png"}).
+		Build()
+	if err != nil {
+		t.Fatalf("MatcherBuilder.Build() error = %v", err)
+	}
+
+	samples := []Sample{
+		{"master", master, map[string]string{"srcImg": "black",
+			"srcImg2": "red"}},
+		{"swapped", swapped, map[string]string{"srcImg": "red",
+			"srcImg2": "black", "missing": "x"}},
+	}
+
+	report, err := RunCorpus(m, SliceSamples(samples))
+	if err != nil {
+		t.Fatalf("RunCorpus() error = %v", err)
+	}
+
+	wantOutcomes := []CorpusOutcome{
+		{"master", "srcImg", "black", "black"},
+		{"master", "srcImg2", "red", "red"},
+		{"swapped", "missing", "x", ""},
+		{"swapped", "srcImg", "red", "red"},
+		{"swapped", "srcImg2", "black", "red"},
+	}
+	if !reflect.DeepEqual(report.Outcomes, wantOutcomes) {
+		t.Errorf("RunCorpus() outcomes = %v, want %v", report.Outcomes,
+			wantOutcomes)
+	}
+
+	wantSources := []SourceAccuracy{
+		{"missing", 1, 0},
+		{"srcImg", 2, 2},
+		{"srcImg2", 2, 1},
+	}
+	if !reflect.DeepEqual(report.Sources, wantSources) {
+		t.Errorf("RunCorpus() sources = %v, want %v", report.Sources,
+			wantSources)
+	}
+	if got := report.Accuracy(); got != 0.6 {
+		t.Errorf("CorpusReport.Accuracy() = %v, want 0.6", got)
+	}
+
+	wantConfusion := []ConfusionMatrix{
+		{
+			Sources: []string{"missing"},
+			Counts:  map[string]map[string]int{"x": {"": 1}},
+		},
+		{
+			Refs:    []string{"black", "red"},
+			Sources: []string{"srcImg", "srcImg2"},
+			Counts: map[string]map[string]int{
+				"black": {"black": 1, "red": 1},
+				"red":   {"red": 2},
+			},
+		},
+	}
+	if !reflect.DeepEqual(report.Confusion, wantConfusion) {
+		t.Errorf("RunCorpus() confusion = %v, want %v", report.Confusion,
+			wantConfusion)
+	}
+	if got := report.Confusion[0].Labels(); !reflect.DeepEqual(got,
+		[]string{"", "x"}) {
+		t.Errorf("ConfusionMatrix.Labels() = %q, want [\"\" x]", got)
+	}
+}
+
+func TestDiffCorpus(t *testing.T) {
+
+	prev := &CorpusReport{Outcomes: []CorpusOutcome{
+		{"a", "src", "1", "1"},
+		{"b", "src", "1", "2"},
+		{"c", "src", "1", "2"},
+		{"d", "src", "1", "1"},
+	}}
+	cur := &CorpusReport{Outcomes: []CorpusOutcome{
+		{"a", "src", "1", ""},
+		{"b", "src", "1", "1"},
+		{"c", "src", "1", "3"},
+		{"d", "src", "1", "1"},
+		{"e", "src", "1", "2"},
+	}}
+
+	changes := DiffCorpus(prev, cur)
+	want := []CorpusChange{
+		{"a", "src", "1", "1", ""},
+		{"b", "src", "1", "2", "1"},
+		{"c", "src", "1", "2", "3"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("DiffCorpus() = %v, want %v", changes, want)
+	}
+
+	tests := []struct {
+		change     CorpusChange
+		regression bool
+		fix        bool
+	}{
+		{changes[0], true, false},
+		{changes[1], false, true},
+		{changes[2], false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.change.Sample, func(t *testing.T) {
+			if got := tt.change.Regression(); got != tt.regression {
+				t.Errorf("CorpusChange.Regression() = %v, want %v", got,
+					tt.regression)
+			}
+			if got := tt.change.Fix(); got != tt.fix {
+				t.Errorf("CorpusChange.Fix() = %v, want %v", got, tt.fix)
+			}
+		})
+	}
+}
+
+func TestCorpusReport_Save(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "pokervision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	report := &CorpusReport{
+		Outcomes: []CorpusOutcome{{"a", "src", "1", ""}},
+		Sources:  []SourceAccuracy{{"src", 1, 0}},
+		Confusion: []ConfusionMatrix{{
+			Refs:    []string{"1"},
+			Sources: []string{"src"},
+			Counts:  map[string]map[string]int{"1": {"": 1}},
+		}},
+	}
+
+	file := filepath.Join(dir, "report.json")
+	if err := report.Save(file); err != nil {
+		t.Fatalf("CorpusReport.Save() error = %v", err)
+	}
+
+	got, err := LoadCorpusReport(file)
+	if err != nil {
+		t.Fatalf("LoadCorpusReport() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, report) {
+		t.Errorf("LoadCorpusReport() = %v, want %v", got, report)
+	}
+
+	if _, err := LoadCorpusReport(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("LoadCorpusReport() expected error for missing file")
+	}
+}
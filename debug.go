@@ -0,0 +1,362 @@
+package pokervision
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// reportTemplate is the template of the HTML debug report.
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>poker-vision report</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; background: #f4f4f4; }
+img { image-rendering: pixelated; border: 1px solid #888; }
+.zoom { transform-origin: top left; height: 48px; }
+.source { background: #fff; margin: 16px 0; padding: 8px; }
+.match { color: #080; font-weight: bold; }
+.nomatch { color: #b00; font-weight: bold; }
+.swatch { display: inline-block; width: 24px; height: 24px; border: 1px solid #888; }
+table { border-collapse: collapse; }
+td, th { padding: 4px 8px; border-bottom: 1px solid #ddd; text-align: left; vertical-align: middle; }
+pre { margin: 0; }
+</style>
+</head>
+<body>
+<h1>poker-vision report</h1>
+<h2>Frame</h2>
+<img src="{{.Overlay}}">
+{{range .Sources}}
+<div class="source">
+<h2>{{.Name}}</h2>
+<p>{{if .Points}}Points: {{.Points}} {{end}}{{if .Grid}}Grid: {{.Grid}} {{end}}{{if not (or .Points .Grid)}}Src: {{.Src}} {{end}}&mdash; result:
+{{if .Result}}<span class="match">{{.Result}}</span>{{else}}<span class="nomatch">no match</span>{{end}}</p>
+{{if .Error}}<p class="nomatch">{{.Error}}</p>{{end}}
+{{if .Classification}}<p>{{.Classification}}</p>{{end}}
+{{if .Crop}}<p><img class="zoom" src="{{.Crop}}"></p>{{end}}
+{{if .Color}}<p>Color: <span class="swatch" style="background: {{.Color}}"></span> {{.Color}}</p>{{end}}
+<table>
+<tr><th>Reference</th><th>Definition</th><th>Reference image</th><th>Score</th><th>Diff</th><th>Details</th></tr>
+{{range .Refs}}
+<tr>
+<td>{{if .Matched}}<span class="match">{{.Name}}</span>{{else}}{{.Name}}{{end}}</td>
+<td><code>{{.Ref}}</code></td>
+<td>{{if .Image}}<img class="zoom" src="{{.Image}}">{{end}}{{if .Color}}<span class="swatch" style="background: {{.Color}}"></span>{{end}}</td>
+<td>{{.Score}}</td>
+<td>{{if .Diff}}<img class="zoom" src="{{.Diff}}">{{end}}</td>
+<td>{{if .Text}}<pre>{{.Text}}</pre>{{end}}{{.Note}}</td>
+</tr>
+{{end}}
+</table>
+</div>
+{{end}}
+</body>
+</html>
+`))
+
+// report is the data rendered by reportTemplate.
+type report struct {
+	Overlay template.URL
+	Sources []sourceReport
+}
+
+// sourceReport describes the outcome of matching a single source.
+type sourceReport struct {
+	Name   string
+	Src    []int
+	Points [][]int
+	Grid   []int
+	Result string
+	Error  string
+	Crop   template.URL
+	Color  template.CSS
+	Refs   []referenceReport
+
+	// Classification describes the best match and the runner-up of a
+	// classifying source.
+	Classification string
+}
+
+// referenceReport describes a comparison between a source and a reference.
+type referenceReport struct {
+	Name    string
+	Ref     string
+	Matched bool
+	Image   template.URL
+	Color   template.CSS
+	Score   string
+	Diff    template.URL
+	Text    string
+	Note    string
+}
+
+// WriteReport writes a self-contained HTML page to w, showing how each source
+// of the matcher is matched in img. The page contains the full frame with all
+// sources drawn on top, the cropped region of each source, every candidate
+// reference with its score and diff, and the raw OCR output.
+func WriteReport(w io.Writer, m Matcher, img image.Image) error {
+
+	im, ok := asMatcher(m)
+	if !ok {
+		return errors.New("Unsupported matcher type")
+	}
+
+	var names []string
+	for _, s := range im.Srcs {
+		if s.validate() == nil {
+			names = append(names, s.Name)
+		}
+	}
+
+	overlay, err := dataURL(im.VisualizeSource(img, names))
+	if err != nil {
+		return err
+	}
+
+	rep := report{Overlay: overlay}
+	for i := range im.Srcs {
+		sr, err := im.reportSource(&im.Srcs[i], img)
+		if err != nil {
+			return err
+		}
+		rep.Sources = append(rep.Sources, sr)
+	}
+
+	return reportTemplate.Execute(w, &rep)
+}
+
+// reportSource builds the report of a single source. Every reference is
+// scored once, and the result is picked from these scores like in Match.
+func (im *matcher) reportSource(s *source, img image.Image) (sourceReport, error) {
+
+	sr := sourceReport{Name: s.Name, Src: s.Src, Points: s.Points, Grid: s.Grid}
+
+	if err := s.validate(); err != nil {
+		sr.Error = err.Error()
+		return sr, nil
+	}
+
+	srcImg, srcColor, isPixel, _ := grabSource(s, img)
+
+	if isPixel {
+		sr.Color = htmlColor(srcColor)
+	} else {
+		crop, err := dataURL(srcImg)
+		if err != nil {
+			return sr, err
+		}
+		sr.Crop = crop
+	}
+
+	// Match stops at the first matching reference, or at the first one which
+	// cannot be compared. Classifying sources fail at the first error.
+	var scores []RefScore
+	var scoreErr error
+	decided := s.Classify
+	for _, r := range im.candidates(s) {
+		rs, err := scoreReference(&r, srcImg, srcColor, isPixel)
+		if err != nil && scoreErr == nil {
+			scoreErr = fmt.Errorf("%v srcName=%v refName=%v", err, s.Name,
+				r.Name)
+		}
+		if !decided && (rs.Matched || stopsMatch(&r, isPixel)) {
+			sr.Result, decided = rs.Result, true
+		}
+		scores = append(scores, rs)
+
+		rr, err := reportReference(&r, rs, err, srcImg, isPixel)
+		if err != nil {
+			return sr, err
+		}
+		sr.Refs = append(sr.Refs, rr)
+	}
+
+	if !s.Classify {
+		return sr, nil
+	}
+
+	if scoreErr != nil {
+		sr.Error = scoreErr.Error()
+		return sr, nil
+	}
+
+	c := classifyScores(s, scores)
+	sr.Result = c.Result()
+	sr.Classification = fmt.Sprintf(
+		"Best %v (%.3f), runner-up %v (%.3f), margin %.3f",
+		c.Best.Name, c.Best.Score, c.RunnerUp.Name, c.RunnerUp.Score,
+		c.Margin)
+	if c.Ambiguous {
+		sr.Classification += ", ambiguous"
+	}
+
+	return sr, nil
+}
+
+// reportReference describes the outcome of scoring a source against a single
+// reference. scoreErr is the error scoring returned.
+func reportReference(r *reference, rs RefScore, scoreErr error,
+	srcImg image.Image, isPixel bool) (referenceReport, error) {
+
+	rr := referenceReport{Name: r.Name, Ref: r.Ref, Matched: rs.Matched}
+
+	spec, err := r.spec()
+	if err != nil {
+		rr.Note = err.Error()
+		return rr, nil
+	}
+	if rr.Ref == "" {
+		rr.Ref = spec.String()
+	}
+	if scoreErr != nil {
+		rr.Note = scoreErr.Error()
+		return rr, nil
+	}
+
+	switch spec.Kind {
+
+	// Color.
+	case RefColor:
+		rr.Color = template.CSS(spec.Color)
+		if rr.Matched {
+			rr.Score = "match"
+		} else {
+			rr.Score = "no match"
+		}
+
+	// OCR.
+	case RefOCR:
+		rr.Text = rs.Text
+		rr.Score = rs.Result
+
+	// Image (monochrome or not).
+	case RefImage, RefImageM:
+		refImg, err := r.loadImage(spec.File)
+		if err != nil {
+			rr.Note = err.Error()
+			break
+		}
+
+		mask, err := r.loadMask(spec, refImg)
+		if err != nil {
+			rr.Note = err.Error()
+			break
+		}
+
+		refImg = preprocess(refImg, spec.Preprocess)
+		if rr.Image, err = dataURL(refImg); err != nil {
+			return rr, err
+		}
+
+		diff, stats, err := diffSpec(refImg,
+			preprocess(srcImg, spec.Preprocess), mask, spec)
+		if err != nil {
+			rr.Score = "0%"
+			rr.Note = err.Error()
+			break
+		}
+
+		if rr.Diff, err = dataURL(diff); err != nil {
+			return rr, err
+		}
+
+		rr.Score = "100%"
+		if stats.Total > 0 {
+			rr.Score = fmt.Sprintf("%.1f%%",
+				100*float64(stats.Total-stats.Differing)/float64(stats.Total))
+		}
+		if !stats.Equal() {
+			rr.Note = fmt.Sprintf("%v differing pixels, max delta %v, bounds %v",
+				stats.Differing, stats.MaxDelta>>8, stats.Bounds)
+		}
+
+	// Edges.
+	case RefEdges:
+		refImg, err := r.loadImage(spec.File)
+		if err != nil {
+			rr.Note = err.Error()
+			break
+		}
+
+		refImg = preprocess(refImg, spec.Preprocess)
+		if rr.Image, err = dataURL(sobelEdges(refImg,
+			spec.Edges.threshold())); err != nil {
+			return rr, err
+		}
+
+		diff, _, err := compareEdges(refImg,
+			preprocess(srcImg, spec.Preprocess), spec.Edges)
+		if err != nil {
+			rr.Score = "0%"
+			rr.Note = err.Error()
+			break
+		}
+
+		if rr.Diff, err = dataURL(diff); err != nil {
+			return rr, err
+		}
+		rr.Score = fmt.Sprintf("%.1f%%", 100*rs.Score)
+
+	// kNN.
+	case RefKNN:
+		rr.Text = rs.Text
+		rr.Score = fmt.Sprintf("%.0f%%", 100*rs.Score)
+
+	// Histogram or dominant color.
+	case RefHistogram, RefDominant:
+		if spec.Kind == RefDominant {
+			rr.Color = template.CSS(spec.Color)
+			rr.Score = fmt.Sprintf("delta %.0f", 255*(1-rs.Score))
+			rr.Note = fmt.Sprintf("Dominant color %v", htmlColor(dominantColor(
+				preprocess(srcImg, spec.Preprocess), spec.Histogram.bins())))
+			break
+		}
+
+		refImg, err := r.loadImage(spec.File)
+		if err != nil {
+			rr.Note = err.Error()
+			break
+		}
+		if rr.Image, err = dataURL(preprocess(refImg, spec.Preprocess)); err != nil {
+			return rr, err
+		}
+		rr.Score = fmt.Sprintf("distance %.3f", 1-rs.Score)
+
+	// Pixel signature.
+	case RefPixels:
+		rr.Score = fmt.Sprintf("%.1f%%", 100*rs.Score)
+		if len(spec.Colors) == 0 {
+			rr.Color = template.CSS(spec.Color)
+		}
+
+	}
+
+	return rr, nil
+}
+
+// htmlColor formats a color as an HTML color.
+func htmlColor(c color.Color) template.CSS {
+	r, g, b, _ := c.RGBA()
+	return template.CSS(fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8))
+}
+
+// dataURL encodes an image as a PNG data URL.
+func dataURL(img image.Image) (template.URL, error) {
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+
+	return template.URL("data:image/png;base64," +
+		base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
@@ -0,0 +1,90 @@
+package pokervision
+
+import (
+	"bytes"
+	"image"
+	"strings"
+	"testing"
+)
+
+type otherMatcher struct{}
+
+func (*otherMatcher) Match(srcName string, img image.Image) string { return "" }
+func (*otherMatcher) VisualizeSource(img image.Image, srcs []string) image.Image {
+	return img
+}
+
+func TestWriteReport(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("WriteReport() failed to load master image. %v", err)
+	}
+
+	m, err := NewMatcher("./testdata/refs.json")
+	if err != nil {
+		t.Errorf("WriteReport() failed to load ref file. %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, m, img); err != nil {
+		t.Fatalf("WriteReport() error = %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		"<html>", "srcImg1", "refImg2", "srcColor1", "#d742f4",
+		"data:image/png;base64,", "100.0%", "differing pixels",
+		"Illegal source",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("WriteReport() output does not contain %q", want)
+		}
+	}
+
+	if err := WriteReport(&buf, &otherMatcher{}, img); err == nil {
+		t.Errorf("WriteReport() error = nil, want error for unsupported matcher")
+	}
+}
+
+func TestWriteReport_pixelSets(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("WriteReport() failed to load master image. %v", err)
+	}
+
+	m, err := NewMatcher("./testdata/pixels.json")
+	if err != nil {
+		t.Fatalf("WriteReport() failed to load ref file. %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, m, img); err != nil {
+		t.Fatalf("WriteReport() error = %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		"Points: [[8 28] [9 28] [10 28] [0 0]]", "Grid: [22 35 8 12 2 3]",
+		"Src: [9 28]",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("WriteReport() output does not contain %q", want)
+		}
+	}
+
+	// The report picks the same result as Match.
+	im, _ := asMatcher(m)
+	for i := range im.Srcs {
+		s := &im.Srcs[i]
+		sr, err := im.reportSource(s, img)
+		if err != nil {
+			t.Fatalf("reportSource(%v) error = %v", s.Name, err)
+		}
+		if want := m.Match(s.Name, img); sr.Result != want {
+			t.Errorf("reportSource(%v).Result = %v, want %v", s.Name, sr.Result,
+				want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package pokervision
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// DiffMode selects how pixels are compared by Diff.
+type DiffMode int
+
+const (
+	// DiffAbsolute compares pixels by the absolute difference of each color
+	// component, like image references do.
+	DiffAbsolute DiffMode = iota
+
+	// DiffMonochrome compares pixels after clamping them to white and
+	// non-white, like imageM references do.
+	DiffMonochrome
+)
+
+// DiffStats summarizes the difference between two images.
+type DiffStats struct {
+	// Total is the number of compared pixels, which excludes pixels outside
+	// the mask.
+	Total int
+
+	// Differing is the number of pixels that are not equal. Comparisons with
+	// a tolerance only count pixels with a color component differing by more
+	// than the tolerance.
+	Differing int
+
+	// MaxDelta is the largest difference of a single color component of all
+	// compared pixels, in the range [0, 65535] used by color.Color.
+	MaxDelta uint32
+
+	// Bounds is the bounding box of the differing pixels, relative to the top
+	// left corner of the images. It is empty if the images are equal.
+	Bounds image.Rectangle
+}
+
+// Equal reports whether no pixels differ.
+func (s DiffStats) Equal() bool {
+	return s.Differing == 0
+}
+
+// Diff compares two equally sized images pixel by pixel. The returned image
+// has the same size as the inputs and origin (0,0). In DiffAbsolute mode each
+// pixel holds the absolute difference of the color components. In
+// DiffMonochrome mode pixels that disagree are white and all other pixels are
+// black.
+func Diff(img1 image.Image, img2 image.Image, mode DiffMode) (image.Image,
+	DiffStats, error) {
+	return DiffMasked(img1, img2, nil, mode)
+}
+
+// DiffMasked works like Diff, but only compares the pixels which have a
+// non-zero value in mask. The mask must have the size of the images, its
+// origin is ignored. A nil mask compares all pixels. Pixels outside the mask
+// are black in the returned image and are not counted in the statistics.
+func DiffMasked(img1 image.Image, img2 image.Image, mask *image.Alpha,
+	mode DiffMode) (image.Image, DiffStats, error) {
+
+	var fg func(c color.Color) bool
+	if mode == DiffMonochrome {
+		fg = isWhite
+	}
+
+	return diffImages(img1, img2, mask, fg, fg, 0)
+}
+
+// diffImages compares two images pixel by pixel, skipping the pixels outside
+// mask. If fg1 and fg2 are given, pixels are clamped to foreground and
+// background using fg1 for img1 and fg2 for img2, and pixels which disagree
+// are white in the returned image. Otherwise the absolute difference of the
+// color components is computed, and pixels only count as differing if a
+// component differs by more than tol, in the range [0, 65535].
+func diffImages(img1 image.Image, img2 image.Image, mask *image.Alpha,
+	fg1 func(c color.Color) bool, fg2 func(c color.Color) bool,
+	tol uint32) (image.Image, DiffStats, error) {
+
+	// Make sure dimensions are equal.
+	if img1.Bounds().Dx() != img2.Bounds().Dx() ||
+		img1.Bounds().Dy() != img2.Bounds().Dy() {
+		return nil, DiffStats{}, fmt.Errorf(
+			"Images are not of the same size img1='%v,%v' img2='%v,%v'",
+			img1.Bounds().Dx(), img1.Bounds().Dy(),
+			img2.Bounds().Dx(), img2.Bounds().Dy())
+	}
+
+	if mask != nil && mask.Bounds().Size() != img1.Bounds().Size() {
+		return nil, DiffStats{}, fmt.Errorf(
+			"Mask is not of the same size as images mask='%v' images='%v'",
+			mask.Bounds().Size(), img1.Bounds().Size())
+	}
+
+	// Get offsets.
+	sx1 := img1.Bounds().Min.X
+	sx2 := img2.Bounds().Min.X
+	sy1 := img1.Bounds().Min.Y
+	sy2 := img2.Bounds().Min.Y
+
+	size := img1.Bounds().Size()
+	diff := image.NewRGBA64(image.Rect(0, 0, size.X, size.Y))
+	stats := DiffStats{}
+
+	// Compare pixels.
+	for x := 0; x < size.X; x++ {
+		for y := 0; y < size.Y; y++ {
+
+			// Skip pixels outside the mask.
+			if mask != nil && mask.AlphaAt(mask.Rect.Min.X+x,
+				mask.Rect.Min.Y+y).A == 0 {
+				diff.SetRGBA64(x, y, color.RGBA64{0, 0, 0, 65535})
+				continue
+			}
+			stats.Total++
+
+			c1 := img1.At(x+sx1, y+sy1)
+			c2 := img2.At(x+sx2, y+sy2)
+
+			var dr, dg, db uint32
+			if fg1 != nil && fg2 != nil {
+				if fg1(c1) != fg2(c2) {
+					dr, dg, db = 65535, 65535, 65535
+				}
+			} else {
+				r1, g1, b1, _ := c1.RGBA()
+				r2, g2, b2, _ := c2.RGBA()
+				dr, dg, db = absDiff(r1, r2), absDiff(g1, g2), absDiff(b1, b2)
+			}
+
+			diff.SetRGBA64(x, y, color.RGBA64{
+				uint16(dr), uint16(dg), uint16(db), 65535})
+
+			// Update statistics.
+			delta := maxUint32(dr, maxUint32(dg, db))
+			stats.MaxDelta = maxUint32(stats.MaxDelta, delta)
+			if delta <= tol {
+				continue
+			}
+
+			stats.Differing++
+			stats.Bounds = stats.Bounds.Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+
+	return diff, stats, nil
+}
+
+// DiffSource compares one of the image references of a source against the
+// region of img described by the source, using the comparison mode and mask of
+// the reference.
+func DiffSource(m Matcher, srcName string, refName string,
+	img image.Image) (image.Image, DiffStats, error) {
+
+	im, ok := asMatcher(m)
+	if !ok {
+		return nil, DiffStats{}, errors.New("Unsupported matcher type")
+	}
+
+	// Locate source.
+	s := im.findSource(srcName)
+	if s == nil {
+		return nil, DiffStats{}, fmt.Errorf("Source does not exist srcName=%v",
+			srcName)
+	}
+
+	srcImg, _, isPixel, ok := grabSource(s, img)
+	if !ok || isPixel {
+		return nil, DiffStats{}, fmt.Errorf("Source is not an image srcName=%v",
+			srcName)
+	}
+
+	// Locate reference.
+	var r *reference
+	for i := range im.Refs {
+		if im.Refs[i].Name == refName {
+			r = &im.Refs[i]
+			break
+		}
+	}
+	if r == nil {
+		return nil, DiffStats{}, fmt.Errorf(
+			"Reference does not exist refName=%v", refName)
+	}
+
+	spec, err := r.spec()
+	if err != nil {
+		return nil, DiffStats{}, err
+	}
+	if !spec.isImage() {
+		return nil, DiffStats{}, fmt.Errorf(
+			"Reference is not an image refName=%v", refName)
+	}
+
+	refImg, err := r.loadImage(spec.File)
+	if err != nil {
+		return nil, DiffStats{}, err
+	}
+
+	mask, err := r.loadMask(spec, refImg)
+	if err != nil {
+		return nil, DiffStats{}, err
+	}
+
+	return diffSpec(preprocess(refImg, spec.Preprocess),
+		preprocess(srcImg, spec.Preprocess), mask, spec)
+}
+
+// diffSpec compares a reference image against a source image as described by
+// the definition of an image reference. Like in Match, pixels within the
+// tolerance of the reference do not count as differing.
+func diffSpec(refImg image.Image, srcImg image.Image, mask *image.Alpha,
+	spec RefSpec) (image.Image, DiffStats, error) {
+
+	if spec.Kind == RefImageM {
+		refFg, srcFg := spec.Monochrome.classifiers()
+		return diffImages(refImg, srcImg, mask, refFg, srcFg, 0)
+	}
+
+	return diffImages(refImg, srcImg, mask, nil, nil,
+		uint32(spec.Tolerance)*257)
+}
+
+// absDiff returns the absolute difference between two color components.
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// maxUint32 returns the larger of two values.
+func maxUint32(a, b uint32) uint32 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,184 @@
+package pokervision
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+
+	img1, err := loadImage("./testdata/redVal.png")
+	if err != nil {
+		t.Errorf("Diff() failed to load test files. %v", err)
+	}
+	img2, err := loadImage("./testdata/blackVal.png")
+	if err != nil {
+		t.Errorf("Diff() failed to load test files. %v", err)
+	}
+	img3, err := loadImage("./testdata/blackValCropped.png")
+	if err != nil {
+		t.Errorf("Diff() failed to load test files. %v", err)
+	}
+	img4, err := loadImage("./testdata/blackValModified.png")
+	if err != nil {
+		t.Errorf("Diff() failed to load test files. %v", err)
+	}
+
+	type args struct {
+		img1 image.Image
+		img2 image.Image
+		mode DiffMode
+	}
+	tests := []struct {
+		name      string
+		args      args
+		wantEqual bool
+		wantErr   bool
+	}{
+		{"Identical", args{img1, img1, DiffAbsolute}, true, false},
+		{"Different", args{img1, img2, DiffAbsolute}, false, false},
+		{"Monochrome identical", args{img1, img2, DiffMonochrome}, true, false},
+		{"Monochrome different", args{img1, img4, DiffMonochrome}, false, false},
+		{"Different size", args{img2, img3, DiffAbsolute}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, stats, err := Diff(tt.args.img1, tt.args.img2, tt.args.mode)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Diff() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if stats.Equal() != tt.wantEqual {
+				t.Errorf("Diff() equal = %v, want %v", stats.Equal(), tt.wantEqual)
+			}
+			if diff.Bounds().Size() != tt.args.img1.Bounds().Size() {
+				t.Errorf("Diff() size = %v, want %v", diff.Bounds().Size(),
+					tt.args.img1.Bounds().Size())
+			}
+			if stats.Equal() && !stats.Bounds.Empty() {
+				t.Errorf("Diff() bounds = %v, want empty", stats.Bounds)
+			}
+		})
+	}
+}
+
+func TestDiff_stats(t *testing.T) {
+
+	img1 := image.NewRGBA(image.Rect(10, 10, 20, 20))
+	img2 := image.NewRGBA(image.Rect(0, 0, 10, 10))
+
+	img2.Set(2, 3, color.RGBA{10, 0, 0, 255})
+	img2.Set(5, 7, color.RGBA{0, 200, 0, 255})
+
+	diff, stats, err := Diff(img1, img2, DiffAbsolute)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+
+	if stats.Total != 100 || stats.Differing != 2 {
+		t.Errorf("Diff() total, differing = %v, %v, want 100, 2", stats.Total,
+			stats.Differing)
+	}
+	if stats.MaxDelta != 200*257 {
+		t.Errorf("Diff() max delta = %v, want %v", stats.MaxDelta, 200*257)
+	}
+	if want := image.Rect(2, 3, 6, 8); stats.Bounds != want {
+		t.Errorf("Diff() bounds = %v, want %v", stats.Bounds, want)
+	}
+	if r, _, _, _ := diff.At(2, 3).RGBA(); r != 10*257 {
+		t.Errorf("Diff() pixel = %v, want %v", r, 10*257)
+	}
+}
+
+func TestDiffSource(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("DiffSource() failed to load master image. %v", err)
+	}
+
+	m, err := NewMatcher("./testdata/refs.json")
+	if err != nil {
+		t.Errorf("DiffSource() failed to load ref file. %v", err)
+	}
+
+	type args struct {
+		srcName string
+		refName string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		wantEqual bool
+		wantErr   bool
+	}{
+		{"Match", args{"srcImg1", "refImg2"}, true, false},
+		{"No match", args{"srcImg2", "refImg1"}, false, false},
+		{"Monochrome match", args{"srcMImg1", "refMImg1"}, true, false},
+		{"Pixel source", args{"srcColor1", "refImg1"}, false, true},
+		{"Color reference", args{"srcImg1", "refColor1"}, false, true},
+		{"No source", args{"noSuchSource", "refImg1"}, false, true},
+		{"No reference", args{"srcImg1", "noSuchRef"}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, stats, err := DiffSource(m, tt.args.srcName, tt.args.refName, img)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DiffSource() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && stats.Equal() != tt.wantEqual {
+				t.Errorf("DiffSource() equal = %v, want %v", stats.Equal(),
+					tt.wantEqual)
+			}
+		})
+	}
+}
+
+func TestDiffSpec_tolerance(t *testing.T) {
+
+	img1 := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	img2 := image.NewRGBA(image.Rect(0, 0, 10, 10))
+
+	img2.Set(2, 3, color.RGBA{10, 0, 0, 255})
+	img2.Set(5, 7, color.RGBA{0, 200, 0, 255})
+
+	tests := []struct {
+		name      string
+		tolerance int
+		differing int
+		bounds    image.Rectangle
+	}{
+		{"No tolerance", 0, 2, image.Rect(2, 3, 6, 8)},
+		{"Small delta within tolerance", 10, 1, image.Rect(5, 7, 6, 8)},
+		{"All within tolerance", 200, 0, image.Rectangle{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := RefSpec{Kind: RefImage, Tolerance: tt.tolerance}
+			_, stats, err := diffSpec(img1, img2, nil, spec)
+			if err != nil {
+				t.Fatalf("diffSpec() error = %v", err)
+			}
+			if stats.Differing != tt.differing {
+				t.Errorf("diffSpec() differing = %v, want %v", stats.Differing,
+					tt.differing)
+			}
+			if stats.Bounds != tt.bounds {
+				t.Errorf("diffSpec() bounds = %v, want %v", stats.Bounds,
+					tt.bounds)
+			}
+			if stats.MaxDelta != 200*257 {
+				t.Errorf("diffSpec() max delta = %v, want %v", stats.MaxDelta,
+					200*257)
+			}
+			if got := compareImagesMasked(img1, img2, nil, spec); got != stats.Equal() {
+				t.Errorf("compareImagesMasked() = %v, want %v", got, stats.Equal())
+			}
+		})
+	}
+}
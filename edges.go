@@ -0,0 +1,217 @@
+package pokervision
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math"
+)
+
+// defaultEdgeThreshold is the default gradient magnitude of an edge pixel.
+const defaultEdgeThreshold = 64
+
+// EdgeOptions configures edge references.
+type EdgeOptions struct {
+
+	// Threshold is the smallest gradient magnitude (1-255) of an edge pixel.
+	// Defaults to 64.
+	Threshold int `json:",omitempty" yaml:"Threshold,omitempty" toml:",omitempty"`
+
+	// Radius is the distance (0-3) in pixels an edge may be shifted and still
+	// be considered equal.
+	Radius int `json:",omitempty" yaml:"Radius,omitempty" toml:",omitempty"`
+
+	// MaxDifference is the largest fraction (0-1) of edge pixels which may
+	// disagree for the reference to match.
+	MaxDifference float64 `json:",omitempty" yaml:"MaxDifference,omitempty" toml:",omitempty"`
+}
+
+// validate checks that the options are well-formed.
+func (o *EdgeOptions) validate() error {
+
+	if o.Threshold < 0 || o.Threshold > 255 {
+		return fmt.Errorf("Illegal edge threshold %v", o.Threshold)
+	}
+
+	if o.Radius < 0 || o.Radius > 3 {
+		return fmt.Errorf("Illegal edge radius %v", o.Radius)
+	}
+
+	if o.MaxDifference < 0 || o.MaxDifference > 1 {
+		return fmt.Errorf("Illegal edge difference %v", o.MaxDifference)
+	}
+
+	return nil
+}
+
+// threshold returns the smallest gradient magnitude of an edge pixel.
+func (o *EdgeOptions) threshold() int {
+	if o == nil || o.Threshold == 0 {
+		return defaultEdgeThreshold
+	}
+	return o.Threshold
+}
+
+// handleEdges handles a comparison with an edge reference.
+func handleEdges(r *reference, srcImg image.Image) string {
+
+	spec, err := r.spec()
+	if err != nil {
+		log.Printf("error: %v refName=%v", err, r.Name)
+		return ""
+	}
+
+	refImg, err := r.loadImage(spec.File)
+	if err != nil {
+		log.Printf("error: %v refName='%v'", err, r.Name)
+		return ""
+	}
+
+	_, difference, err := compareEdges(preprocess(refImg, spec.Preprocess),
+		preprocess(srcImg, spec.Preprocess), spec.Edges)
+	if err != nil {
+		log.Printf("error: %v refName='%v'", err, r.Name)
+		return ""
+	}
+
+	if edgesMatch(spec, difference) {
+		return r.result()
+	}
+
+	return ""
+}
+
+// edgesMatch reports whether the edge maps of an edge reference and a region
+// differ by at most the largest difference allowed.
+func edgesMatch(spec RefSpec, difference float64) bool {
+
+	maxDifference := 0.0
+	if spec.Edges != nil {
+		maxDifference = spec.Edges.MaxDifference
+	}
+
+	// Allow for rounding errors.
+	return difference <= maxDifference+1e-9
+}
+
+// compareEdges compares the edge maps of two equally sized images. An edge
+// pixel of one image disagrees if the other image has no edge pixel within
+// the radius. The returned image is white where edge pixels disagree, gray
+// where they agree and black elsewhere. difference is the fraction of edge
+// pixels which disagree, 0 if neither image has edges.
+func compareEdges(refImg image.Image, srcImg image.Image,
+	opts *EdgeOptions) (diff *image.Gray, difference float64, err error) {
+
+	// Make sure dimensions are equal.
+	if refImg.Bounds().Size() != srcImg.Bounds().Size() {
+		return nil, 0, fmt.Errorf(
+			"Images are not of the same size img1='%v' img2='%v'",
+			refImg.Bounds().Size(), srcImg.Bounds().Size())
+	}
+
+	threshold := opts.threshold()
+	radius := 0
+	if opts != nil {
+		radius = opts.Radius
+	}
+
+	e1 := sobelEdges(refImg, threshold)
+	e2 := sobelEdges(srcImg, threshold)
+
+	size := refImg.Bounds().Size()
+	diff = image.NewGray(image.Rect(0, 0, size.X, size.Y))
+
+	var edges, disagree int
+	for x := 0; x < size.X; x++ {
+		for y := 0; y < size.Y; y++ {
+			for _, pair := range [2][2]*image.Gray{{e1, e2}, {e2, e1}} {
+				if pair[0].GrayAt(x, y).Y == 0 {
+					continue
+				}
+
+				edges++
+				if edgeNear(pair[1], x, y, radius) {
+					if diff.GrayAt(x, y).Y == 0 {
+						diff.SetGray(x, y, color.Gray{128})
+					}
+				} else {
+					disagree++
+					diff.SetGray(x, y, color.Gray{255})
+				}
+			}
+		}
+	}
+
+	if edges == 0 {
+		return diff, 0, nil
+	}
+
+	return diff, float64(disagree) / float64(edges), nil
+}
+
+// edgeNear reports whether the edge map has an edge pixel within radius of
+// (x,y).
+func edgeNear(edges *image.Gray, x, y, radius int) bool {
+
+	for dx := -radius; dx <= radius; dx++ {
+		for dy := -radius; dy <= radius; dy++ {
+			p := image.Pt(x+dx, y+dy)
+			if p.In(edges.Rect) && edges.GrayAt(p.X, p.Y).Y != 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// sobelEdges computes the binarized Sobel edge map of an image. Pixels with a
+// gradient magnitude of at least threshold (0-255) are white, all other pixels
+// are black. The map has origin (0,0). Pixels outside the image are treated
+// as copies of the nearest border pixel.
+func sobelEdges(img image.Image, threshold int) *image.Gray {
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	// Compute luminance.
+	lum := make([]float64, w*h)
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			r, g, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			lum[y*w+x] = float64((19595*r+38470*g+7471*bl+1<<15)>>16) / 65535
+		}
+	}
+
+	at := func(x, y int) float64 {
+		if x < 0 {
+			x = 0
+		} else if x >= w {
+			x = w - 1
+		}
+		if y < 0 {
+			y = 0
+		} else if y >= h {
+			y = h - 1
+		}
+		return lum[y*w+x]
+	}
+
+	edges := image.NewGray(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) -
+				at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) -
+				at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+
+			// The magnitude of a step from black to white is 4.
+			if 255*math.Hypot(gx, gy)/4 >= float64(threshold) {
+				edges.SetGray(x, y, color.Gray{255})
+			}
+		}
+	}
+
+	return edges
+}
@@ -0,0 +1,145 @@
+package pokervision
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestNewMatcher_edges(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("NewMatcher() failed to load master image. %v", err)
+	}
+
+	m, err := NewMatcher("./testdata/edges.json")
+	if err != nil {
+		t.Fatalf("NewMatcher() failed to load ref file. %v", err)
+	}
+
+	tests := []struct {
+		srcName string
+		wantRef string
+	}{
+		{"srcImg1", "refEdgesBlack"},
+		{"srcImg2", "refEdgesBlackShifted"},
+		{"srcImg3", ""},
+		{"srcImg4", "refEdgesBlackShifted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.srcName, func(t *testing.T) {
+			if got := m.Match(tt.srcName, img); got != tt.wantRef {
+				t.Errorf("matcher.Match() = %v, want %v", got, tt.wantRef)
+			}
+		})
+	}
+}
+
+func Test_sobelEdges(t *testing.T) {
+
+	// Left half black, right half white.
+	img := image.NewGray(image.Rect(10, 10, 16, 13))
+	for x := 13; x < 16; x++ {
+		for y := 10; y < 13; y++ {
+			img.SetGray(x, y, color.Gray{255})
+		}
+	}
+
+	edges := sobelEdges(img, 64)
+	if edges.Bounds() != image.Rect(0, 0, 6, 3) {
+		t.Fatalf("sobelEdges() bounds = %v, want (0,0)-(6,3)", edges.Bounds())
+	}
+	for x := 0; x < 6; x++ {
+		want := x == 2 || x == 3
+		if got := edges.GrayAt(x, 1).Y != 0; got != want {
+			t.Errorf("sobelEdges() edge at x=%v = %v, want %v", x, got, want)
+		}
+	}
+
+	// A weak step is not an edge.
+	if edges := sobelEdges(img, 255); edges.GrayAt(2, 1).Y == 0 {
+		t.Errorf("sobelEdges() threshold 255 = no edge, want edge")
+	}
+}
+
+func Test_compareEdges(t *testing.T) {
+
+	blackVal, err := loadImage("./testdata/blackVal.png")
+	if err != nil {
+		t.Errorf("compareEdges() failed to load test files. %v", err)
+	}
+
+	// Darker, green tinted copy.
+	b := blackVal.Bounds()
+	tinted := image.NewRGBA(b)
+	mirrored := image.NewRGBA(b)
+	for x := b.Min.X; x < b.Max.X; x++ {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			r, g, bl, _ := blackVal.At(x, y).RGBA()
+			tinted.Set(x, y, color.RGBA{uint8(r >> 9), uint8(g>>9 + 60),
+				uint8(bl >> 9), 255})
+			mirrored.Set(b.Max.X-1-(x-b.Min.X), y, blackVal.At(x, y))
+		}
+	}
+
+	tests := []struct {
+		name      string
+		img       image.Image
+		opts      *EdgeOptions
+		wantEqual bool
+		wantErr   bool
+	}{
+		{"Identical", blackVal, nil, true, false},
+		{"Tinted", tinted, &EdgeOptions{MaxDifference: 0.1}, true, false},
+		{"Mirrored", mirrored, &EdgeOptions{MaxDifference: 0.1}, false, false},
+		{"Mirrored with radius", mirrored, &EdgeOptions{Radius: 1}, true, false},
+		{"Size mismatch", image.NewRGBA(image.Rect(0, 0, 1, 1)), nil, false,
+			true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, difference, err := compareEdges(blackVal, tt.img, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("compareEdges() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			maxDifference := 0.0
+			if tt.opts != nil {
+				maxDifference = tt.opts.MaxDifference
+			}
+			if got := err == nil && difference <= maxDifference; got != tt.wantEqual {
+				t.Errorf("compareEdges() = %v, want equal %v", difference,
+					tt.wantEqual)
+			}
+		})
+	}
+
+	// Plain image comparison fails on the tinted copy.
+	if compareImagesTolerance(blackVal, tinted, 32) {
+		t.Errorf("compareImagesTolerance() = true, want false")
+	}
+}
+
+func TestEdgeOptions_validate(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		opts    EdgeOptions
+		wantErr bool
+	}{
+		{"Defaults", EdgeOptions{}, false},
+		{"Valid", EdgeOptions{Threshold: 100, Radius: 2, MaxDifference: 0.3},
+			false},
+		{"Threshold out of range", EdgeOptions{Threshold: 256}, true},
+		{"Radius out of range", EdgeOptions{Radius: 4}, true},
+		{"Difference out of range", EdgeOptions{MaxDifference: -0.1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("EdgeOptions.validate() error = %v, wantErr %v", err,
+					tt.wantErr)
+			}
+		})
+	}
+}
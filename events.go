@@ -0,0 +1,450 @@
+package pokervision
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventKind is the kind of a table event.
+type EventKind int
+
+const (
+	// EventNewHand is emitted when a new hand starts: the dealer button
+	// moves, the board is cleared or the hero is dealt different cards.
+	EventNewHand EventKind = iota
+
+	// EventCardsDealt is emitted when all hole cards of a seat are visible
+	// and differ from before.
+	EventCardsDealt
+
+	// EventStackChanged is emitted when the stack of a seat changes.
+	EventStackChanged
+
+	// EventBetChanged is emitted when the bet of a seat changes.
+	EventBetChanged
+
+	// EventPotChanged is emitted when the pot changes.
+	EventPotChanged
+
+	// EventBoardDealt is emitted for each street dealt: the flop, the turn
+	// and the river.
+	EventBoardDealt
+
+	// EventHeroToAct is emitted when the hero gets to act.
+	EventHeroToAct
+
+	// EventFolded is emitted when a seat leaves the hand, i.e. its Active
+	// source stops matching. Since the cards of all seats are cleared when a
+	// hand ends, folds are emitted with the next frame, and not at all if
+	// that frame or the one they were seen in starts a new hand, or if no
+	// seat is left in the hand.
+	EventFolded
+
+	// EventNameChanged is emitted when the name of the player in a seat
+	// changes.
+	EventNameChanged
+)
+
+// Streets of the board.
+const (
+	StreetFlop  = "flop"
+	StreetTurn  = "turn"
+	StreetRiver = "river"
+)
+
+// Event is a change of the table state between consecutive frames.
+type Event struct {
+	Kind EventKind
+
+	// Time is the time of the frame the change was seen in.
+	Time time.Time
+
+	// Seat is the number (1-based) of the seat which changed, or 0.
+	Seat int
+
+	// Old and New are the values before and after the change, for stack, bet,
+	// pot, name and hero to act events.
+	Old string
+	New string
+
+	// Cards are the cards dealt, for cards and board events.
+	Cards []string
+
+	// Street is the street dealt, for board events.
+	Street string
+}
+
+// String describes the event, e.g. "seat 3 bet changed 20→60".
+func (e Event) String() string {
+	switch e.Kind {
+	case EventNewHand:
+		return "new hand started"
+	case EventCardsDealt:
+		return fmt.Sprintf("seat %v dealt: %v", e.Seat,
+			strings.Join(e.Cards, " "))
+	case EventStackChanged:
+		return fmt.Sprintf("seat %v stack changed %v→%v", e.Seat, e.Old, e.New)
+	case EventBetChanged:
+		return fmt.Sprintf("seat %v bet changed %v→%v", e.Seat, e.Old, e.New)
+	case EventPotChanged:
+		return fmt.Sprintf("pot changed %v→%v", e.Old, e.New)
+	case EventBoardDealt:
+		return fmt.Sprintf("%v dealt: %v", e.Street, strings.Join(e.Cards, " "))
+	case EventHeroToAct:
+		return "hero to act"
+	case EventFolded:
+		return fmt.Sprintf("seat %v folded", e.Seat)
+	case EventNameChanged:
+		return fmt.Sprintf("seat %v name changed %v→%v", e.Seat, e.Old, e.New)
+	}
+	return fmt.Sprintf("event %d", int(e.Kind))
+}
+
+// SeatLayout names the sources describing a seat.
+type SeatLayout struct {
+
+	// Name matches the name of the player in the seat. Changes are emitted
+	// as EventNameChanged events.
+	Name string
+
+	Cards []string
+	Stack string
+	Bet   string
+
+	// Active matches while the seat takes part in the hand, e.g. by the backs
+	// of its cards.
+	Active string
+}
+
+// TableLayout names the sources describing the table. Empty names are not
+// read.
+type TableLayout struct {
+
+	// Seats describes the seats, seat 1 first.
+	Seats []SeatLayout
+
+	// Hero is the number (1-based) of the seat of the hero, or 0.
+	Hero int
+
+	// Board lists the sources of the board cards, in the order they are
+	// dealt.
+	Board []string
+
+	Pot    string
+	Button string
+
+	// HeroToAct matches when the hero has to act, e.g. by the action buttons.
+	HeroToAct string
+}
+
+// sources returns the names of the sources of the layout, each once.
+func (l *TableLayout) sources() []string {
+
+	var srcs []string
+	add := func(names ...string) {
+		for _, name := range names {
+			if name != "" && !containsString(srcs, name) {
+				srcs = append(srcs, name)
+			}
+		}
+	}
+
+	for _, seat := range l.Seats {
+		add(seat.Name)
+		add(seat.Cards...)
+		add(seat.Stack, seat.Bet, seat.Active)
+	}
+	add(l.Board...)
+	add(l.Pot, l.Button, l.HeroToAct)
+
+	return srcs
+}
+
+// EventStream compares the table state of consecutive frames and emits the
+// changes as events.
+type EventStream interface {
+
+	// Events returns the channel the events are sent to. It is closed by
+	// Close.
+	Events() <-chan Event
+
+	// Frame reads the table state from a frame captured at time t and sends
+	// the changes since the previous frame. It blocks while the channel is
+	// full, until Close is called. The first frame is compared against an
+	// empty table and never starts a new hand.
+	Frame(img image.Image, t time.Time)
+
+	// Close closes the channel. Later frames are ignored.
+	Close()
+}
+
+// NewEventStream creates an event stream reading the sources of layout with
+// m. Values are stabilized as described by st before they are compared, see
+// NewSmoothedReader. buffer is the capacity of the channel.
+func NewEventStream(m Matcher, layout TableLayout, st Stability,
+	buffer int) EventStream {
+
+	return &eventStream{
+		table:  newTableReader(m, layout, st),
+		events: make(chan Event, buffer),
+		done:   make(chan struct{}),
+	}
+}
+
+// eventStream implements EventStream.
+type eventStream struct {
+	mu     sync.Mutex
+	table  *tableReader
+	events chan Event
+	closed bool
+
+	// done is closed by Close before it waits for the lock, which releases a
+	// frame blocked on a full channel.
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Events returns the channel the events are sent to.
+func (es *eventStream) Events() <-chan Event {
+	return es.events
+}
+
+// Frame reads a frame and sends the changes.
+func (es *eventStream) Frame(img image.Image, t time.Time) {
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	if es.closed {
+		return
+	}
+
+	for _, e := range es.table.read(img, t) {
+		select {
+		case es.events <- e:
+		case <-es.done:
+			return
+		}
+	}
+}
+
+// Close closes the channel.
+func (es *eventStream) Close() {
+
+	es.closeOnce.Do(func() {
+		close(es.done)
+	})
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	if !es.closed {
+		es.closed = true
+		close(es.events)
+	}
+}
+
+// tableReader reads the table state of consecutive frames and returns the
+// changes as events. It is shared by the event stream and the hand recorder,
+// and is not safe for concurrent use.
+type tableReader struct {
+	layout TableLayout
+	reader SmoothedReader
+
+	// state holds the values of the sources in the previous frame. seen
+	// tells if a frame has been read.
+	state map[string]string
+	seen  bool
+
+	// folds holds the folds seen in the previous frame, which are emitted
+	// unless the next frame starts a new hand.
+	folds []Event
+}
+
+// newTableReader creates a table reader reading the sources of layout with m.
+// Values are stabilized as described by st.
+func newTableReader(m Matcher, layout TableLayout, st Stability) *tableReader {
+	return &tableReader{
+		layout: layout,
+		reader: NewSmoothedReader(m, st, nil),
+		state:  make(map[string]string),
+	}
+}
+
+// read reads the table state from a frame and returns the changes since the
+// previous frame.
+func (tr *tableReader) read(img image.Image, t time.Time) []Event {
+
+	state := make(map[string]string)
+	for _, srcName := range tr.layout.sources() {
+		state[srcName] = tr.reader.Read(srcName, img, t)
+	}
+
+	events := tr.changes(tr.state, state, t)
+	tr.state = state
+	tr.seen = true
+
+	return tr.deferFolds(events)
+}
+
+// deferFolds holds back the folds among the events of a frame until the next
+// frame is read, and drops the folds held back if the events start a new
+// hand.
+func (tr *tableReader) deferFolds(events []Event) []Event {
+
+	var out []Event
+	if len(events) == 0 || events[0].Kind != EventNewHand {
+		out = append(out, tr.folds...)
+	}
+
+	tr.folds = nil
+	for _, e := range events {
+		if e.Kind == EventFolded {
+			tr.folds = append(tr.folds, e)
+		} else {
+			out = append(out, e)
+		}
+	}
+
+	return out
+}
+
+// changes returns the events between two table states, in the order new hand,
+// seats, pot, board and hero to act.
+func (tr *tableReader) changes(prev, cur map[string]string,
+	t time.Time) []Event {
+
+	l := &tr.layout
+	var events []Event
+	emit := func(e Event) {
+		e.Time = t
+		events = append(events, e)
+	}
+
+	prevBoard := dealtCards(prev, l.Board)
+	curBoard := dealtCards(cur, l.Board)
+
+	// Detect a new hand.
+	newHand := false
+	if tr.seen {
+		newHand = len(prevBoard) > 0 && len(curBoard) == 0
+		if l.Button != "" && cur[l.Button] != prev[l.Button] &&
+			cur[l.Button] != "" {
+			newHand = true
+		}
+		if l.Hero > 0 && l.Hero <= len(l.Seats) {
+			cards := l.Seats[l.Hero-1].Cards
+			was, is := holeCards(prev, cards), holeCards(cur, cards)
+			if was != nil && is != nil && !equalStrings(was, is) {
+				newHand = true
+			}
+		}
+		if newHand {
+			emit(Event{Kind: EventNewHand})
+		}
+	}
+
+	// Seats leave the hand when their cards are cleared at its end, which is
+	// no fold. Someone is always left in a hand after a fold.
+	inHand := false
+	for _, seat := range l.Seats {
+		if seat.Active != "" && cur[seat.Active] != "" {
+			inHand = true
+		}
+	}
+
+	for i, seat := range l.Seats {
+		if seat.Name != "" && cur[seat.Name] != prev[seat.Name] {
+			emit(Event{Kind: EventNameChanged, Seat: i + 1,
+				Old: prev[seat.Name], New: cur[seat.Name]})
+		}
+		if cards := holeCards(cur, seat.Cards); cards != nil &&
+			!equalStrings(cards, holeCards(prev, seat.Cards)) {
+			emit(Event{Kind: EventCardsDealt, Seat: i + 1, Cards: cards})
+		}
+		if seat.Stack != "" && cur[seat.Stack] != prev[seat.Stack] {
+			emit(Event{Kind: EventStackChanged, Seat: i + 1,
+				Old: prev[seat.Stack], New: cur[seat.Stack]})
+		}
+		if seat.Bet != "" && cur[seat.Bet] != prev[seat.Bet] {
+			emit(Event{Kind: EventBetChanged, Seat: i + 1,
+				Old: prev[seat.Bet], New: cur[seat.Bet]})
+		}
+		if seat.Active != "" && prev[seat.Active] != "" &&
+			cur[seat.Active] == "" && inHand && !newHand {
+			emit(Event{Kind: EventFolded, Seat: i + 1})
+		}
+	}
+
+	if l.Pot != "" && cur[l.Pot] != prev[l.Pot] {
+		emit(Event{Kind: EventPotChanged, Old: prev[l.Pot], New: cur[l.Pot]})
+	}
+
+	// Emit each street reached since the previous frame.
+	streets := []struct {
+		name     string
+		from, to int
+	}{{StreetFlop, 0, 3}, {StreetTurn, 3, 4}, {StreetRiver, 4, 5}}
+	for _, s := range streets {
+		if len(prevBoard) < s.to && len(curBoard) >= s.to {
+			emit(Event{Kind: EventBoardDealt, Street: s.name,
+				Cards: curBoard[s.from:s.to]})
+		}
+	}
+
+	if l.HeroToAct != "" && prev[l.HeroToAct] == "" && cur[l.HeroToAct] != "" {
+		emit(Event{Kind: EventHeroToAct, New: cur[l.HeroToAct]})
+	}
+
+	return events
+}
+
+// dealtCards returns the cards of the board sources up to the first one
+// without a card.
+func dealtCards(state map[string]string, srcs []string) []string {
+
+	var cards []string
+	for _, srcName := range srcs {
+		if state[srcName] == "" {
+			break
+		}
+		cards = append(cards, state[srcName])
+	}
+
+	return cards
+}
+
+// holeCards returns the cards of a seat, or nil unless all are visible.
+func holeCards(state map[string]string, srcs []string) []string {
+
+	if len(srcs) == 0 {
+		return nil
+	}
+
+	cards := make([]string, len(srcs))
+	for i, srcName := range srcs {
+		if cards[i] = state[srcName]; cards[i] == "" {
+			return nil
+		}
+	}
+
+	return cards
+}
+
+// equalStrings reports whether two slices hold the same strings.
+func equalStrings(s1, s2 []string) bool {
+
+	if len(s1) != len(s2) {
+		return false
+	}
+	for i := range s1 {
+		if s1[i] != s2[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,215 @@
+package pokervision
+
+import (
+	"image"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// tableFrame is a frame holding the values of its sources.
+type tableFrame struct {
+	image.Image
+	values map[string]string
+}
+
+// tableMatcher returns the values held by table frames.
+type tableMatcher struct{}
+
+func (*tableMatcher) Match(srcName string, img image.Image) string {
+	return img.(*tableFrame).values[srcName]
+}
+func (*tableMatcher) VisualizeSource(img image.Image, srcs []string) image.Image {
+	return img
+}
+
+func TestNewEventStream(t *testing.T) {
+
+	layout := TableLayout{
+		Seats: []SeatLayout{
+			{Cards: []string{"s1c1", "s1c2"}, Stack: "s1stack", Bet: "s1bet"},
+			{Stack: "s2stack", Bet: "s2bet"},
+			{Stack: "s3stack", Bet: "s3bet"},
+		},
+		Hero:      1,
+		Board:     []string{"b1", "b2", "b3", "b4", "b5"},
+		Pot:       "pot",
+		Button:    "button",
+		HeroToAct: "fold",
+	}
+
+	frames := []map[string]string{
+		{"button": "seat2", "s3bet": "20"},
+		{"button": "seat2", "s3bet": "60", "s1c1": "Qs", "s1c2": "Jh"},
+		{"button": "seat2", "s3bet": "60", "s1c1": "Qs", "s1c2": "Jh",
+			"fold": "Fold"},
+		{"button": "seat2", "s1c1": "Qs", "s1c2": "Jh", "pot": "120",
+			"b1": "Ah", "b2": "Kd", "b3": "7c"},
+		{"button": "seat2", "s1c1": "Qs", "s1c2": "Jh", "pot": "120",
+			"b1": "Ah", "b2": "Kd", "b3": "7c", "b4": "2s", "b5": "9d"},
+		{"button": "seat3", "s1c1": "As", "s1c2": "Ac"},
+	}
+	want := [][]string{
+		{"seat 3 bet changed →20"},
+		{"seat 1 dealt: Qs Jh", "seat 3 bet changed 20→60"},
+		{"hero to act"},
+		{"seat 3 bet changed 60→", "pot changed →120", "flop dealt: Ah Kd 7c"},
+		{"turn dealt: 2s", "river dealt: 9d"},
+		{"new hand started", "seat 1 dealt: As Ac", "pot changed 120→"},
+	}
+
+	es := NewEventStream(new(tableMatcher), layout, Stability{}, 16)
+
+	start := time.Now()
+	for i, values := range frames {
+		ts := start.Add(time.Duration(i) * time.Second)
+		es.Frame(&tableFrame{values: values}, ts)
+
+		var got []string
+		for len(es.Events()) > 0 {
+			e := <-es.Events()
+			if !e.Time.Equal(ts) {
+				t.Errorf("Event.Time = %v, want %v", e.Time, ts)
+			}
+			got = append(got, e.String())
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("EventStream.Frame() frame %v = %q, want %q", i, got,
+				want[i])
+		}
+	}
+
+	es.Close()
+	es.Frame(&tableFrame{values: frames[0]}, start)
+	if _, ok := <-es.Events(); ok {
+		t.Errorf("EventStream.Close() did not close the channel")
+	}
+	es.Close()
+}
+
+func TestNewEventStream_folded(t *testing.T) {
+
+	layout := TableLayout{
+		Seats: []SeatLayout{
+			{Name: "s1name", Active: "s1active"},
+			{Name: "s2name", Active: "s2active"},
+			{Name: "s3name", Active: "s3active"},
+		},
+		Button: "button",
+	}
+	es := NewEventStream(new(tableMatcher), layout, Stability{}, 16)
+
+	names := map[string]string{"s1name": "alice", "s2name": "bob",
+		"s3name": "carol"}
+	frame := func(values map[string]string) map[string]string {
+		for k, v := range names {
+			if _, ok := values[k]; !ok {
+				values[k] = v
+			}
+		}
+		return values
+	}
+
+	frames := []map[string]string{
+		frame(map[string]string{"button": "1"}),
+		frame(map[string]string{"button": "1", "s1active": "x",
+			"s2active": "x", "s3active": "x"}),
+		// Seat 3 folds.
+		frame(map[string]string{"button": "1", "s1active": "x",
+			"s2active": "x"}),
+		frame(map[string]string{"button": "1", "s1active": "x",
+			"s2active": "x"}),
+		// Seat 2 leaves right before the next hand.
+		frame(map[string]string{"button": "1", "s1active": "x"}),
+		frame(map[string]string{"button": "2", "s1active": "x"}),
+		frame(map[string]string{"button": "2", "s1active": "x",
+			"s2active": "x", "s3active": "x"}),
+		// Seat 3 leaves as the next hand starts.
+		frame(map[string]string{"button": "3", "s1active": "x",
+			"s2active": "x"}),
+		// All cards are cleared.
+		frame(map[string]string{"button": "3"}),
+		frame(map[string]string{"button": "3", "s2name": "dave"}),
+	}
+	for i, values := range frames {
+		es.Frame(&tableFrame{values: values}, time.Unix(int64(i), 0))
+	}
+	es.Close()
+
+	var got []Event
+	for e := range es.Events() {
+		got = append(got, e)
+	}
+
+	want := []Event{
+		{Kind: EventNameChanged, Time: time.Unix(0, 0), Seat: 1, New: "alice"},
+		{Kind: EventNameChanged, Time: time.Unix(0, 0), Seat: 2, New: "bob"},
+		{Kind: EventNameChanged, Time: time.Unix(0, 0), Seat: 3, New: "carol"},
+		{Kind: EventFolded, Time: time.Unix(2, 0), Seat: 3},
+		{Kind: EventNewHand, Time: time.Unix(5, 0)},
+		{Kind: EventNewHand, Time: time.Unix(7, 0)},
+		{Kind: EventNameChanged, Time: time.Unix(9, 0), Seat: 2, Old: "bob",
+			New: "dave"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EventStream events = %v, want %v", got, want)
+	}
+}
+
+func TestNewEventStream_stability(t *testing.T) {
+
+	layout := TableLayout{Pot: "pot", Board: []string{"b1", "b2", "b3"}}
+	es := NewEventStream(new(tableMatcher), layout, Stability{Frames: 2}, 16)
+
+	frames := []map[string]string{
+		{"pot": "10"},
+		{"pot": "10"},
+		{"pot": "80"},
+		{"pot": "10"},
+		{"pot": "10", "b1": "Ah", "b2": "Kd", "b3": "7c"},
+		{"pot": "10", "b1": "Ah", "b2": "Kd", "b3": "7c"},
+	}
+	for i, values := range frames {
+		es.Frame(&tableFrame{values: values},
+			time.Unix(int64(i), 0))
+	}
+	es.Close()
+
+	var got []Event
+	for e := range es.Events() {
+		got = append(got, e)
+	}
+
+	want := []Event{
+		{Kind: EventPotChanged, Time: time.Unix(1, 0), New: "10"},
+		{Kind: EventBoardDealt, Time: time.Unix(5, 0), Street: StreetFlop,
+			Cards: []string{"Ah", "Kd", "7c"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EventStream events = %v, want %v", got, want)
+	}
+}
+
+func TestNewEventStream_closeBlocked(t *testing.T) {
+
+	layout := TableLayout{Pot: "pot"}
+	es := NewEventStream(new(tableMatcher), layout, Stability{}, 0)
+
+	// Nobody drains the channel, so the frame blocks until the stream is
+	// closed.
+	done := make(chan struct{})
+	go func() {
+		es.Frame(&tableFrame{values: map[string]string{"pot": "10"}},
+			time.Now())
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	es.Close()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("EventStream.Frame() still blocked after Close()")
+	}
+}
@@ -0,0 +1,146 @@
+package pokervision
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// RefFormat is the encoding of a ref file.
+type RefFormat int
+
+const (
+	// FormatJSON is the JSON encoding.
+	FormatJSON RefFormat = iota
+
+	// FormatYAML is the YAML encoding.
+	FormatYAML
+
+	// FormatTOML is the TOML encoding.
+	FormatTOML
+)
+
+// String returns the name of the format.
+func (f RefFormat) String() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatYAML:
+		return "yaml"
+	case FormatTOML:
+		return "toml"
+	}
+	return fmt.Sprintf("RefFormat(%d)", int(f))
+}
+
+// tomlKey matches a TOML table header or key/value pair.
+var tomlKey = regexp.MustCompile(`^(\[|[A-Za-z0-9_"-]+\s*=)`)
+
+// refFormat determines the format of a ref file from the file extension. If
+// the extension is unknown, the content is inspected.
+func refFormat(refFile string, data []byte) RefFormat {
+
+	switch strings.ToLower(filepath.Ext(refFile)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	}
+
+	// Look at the first line which is neither empty nor a comment.
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "{"):
+			return FormatJSON
+		case tomlKey.MatchString(line):
+			return FormatTOML
+		}
+		break
+	}
+
+	return FormatYAML
+}
+
+// unmarshalRefs decodes the content of a ref file into m.
+func unmarshalRefs(refFile string, data []byte, m *matcher) error {
+
+	switch refFormat(refFile, data) {
+	case FormatYAML:
+		return yaml.Unmarshal(data, m)
+	case FormatTOML:
+		_, err := toml.Decode(string(data), m)
+		return err
+	}
+
+	return json.Unmarshal(data, m)
+}
+
+// ExportMatcher writes the sources and references of a matcher to w, encoded
+// in the given format. Included files and templates are written in their
+// resolved form. References whose image or examples are only held in memory
+// cannot be exported.
+func ExportMatcher(w io.Writer, m Matcher, format RefFormat) error {
+
+	im, ok := asMatcher(m)
+	if !ok {
+		return errors.New("Unsupported matcher type")
+	}
+
+	// References held in memory cannot be loaded again without their file.
+	for i := range im.Refs {
+		r := &im.Refs[i]
+		if r.img == nil && r.knn == nil {
+			continue
+		}
+		spec, err := r.spec()
+		if err != nil {
+			return fmt.Errorf("%v refName=%v", err, r.Name)
+		}
+		if err := spec.validate(false); err != nil {
+			return fmt.Errorf("Reference held in memory cannot be exported refName=%v",
+				r.Name)
+		}
+	}
+
+	out := &matcher{Srcs: im.Srcs, Refs: im.Refs}
+
+	switch format {
+	case FormatJSON:
+		b, err := json.MarshalIndent(out, "", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(b, '\n'))
+		return err
+
+	case FormatYAML:
+		b, err := yaml.Marshal(out)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+
+	case FormatTOML:
+		return toml.NewEncoder(w).Encode(out)
+	}
+
+	return fmt.Errorf("Unsupported format format=%v", format)
+}
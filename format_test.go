@@ -0,0 +1,174 @@
+package pokervision
+
+import (
+	"bytes"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewMatcher_formats(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("NewMatcher() failed to load master image. %v", err)
+	}
+
+	want, err := loadMatcher("./testdata/refs.json")
+	if err != nil {
+		t.Fatalf("NewMatcher() failed to load ref file. %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "pokervision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A TOML ref file without extension is detected by its content.
+	b, err := ioutil.ReadFile("./testdata/refs.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	noExt := filepath.Join(dir, "refs")
+	if err := ioutil.WriteFile(noExt, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		refFile string
+	}{
+		{"YAML", "./testdata/refs.yaml"},
+		{"TOML", "./testdata/refs.toml"},
+		{"TOML without extension", noExt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMatcher(tt.refFile)
+			if err != nil {
+				t.Fatalf("NewMatcher() error = %v", err)
+			}
+			im := m.(*matcher)
+			if !reflect.DeepEqual(im.Srcs, want.Srcs) {
+				t.Errorf("NewMatcher() srcs = %v, want %v", im.Srcs, want.Srcs)
+			}
+			if !reflect.DeepEqual(im.Refs, want.Refs) {
+				t.Errorf("NewMatcher() refs = %v, want %v", im.Refs, want.Refs)
+			}
+			if got := m.Match("srcImg1", img); got != "refImg2" {
+				t.Errorf("matcher.Match() = %v, want refImg2", got)
+			}
+		})
+	}
+}
+
+func Test_refFormat(t *testing.T) {
+
+	type args struct {
+		refFile string
+		data    string
+	}
+	tests := []struct {
+		name string
+		args args
+		want RefFormat
+	}{
+		{"JSON extension", args{"refs.json", ""}, FormatJSON},
+		{"YAML extension", args{"refs.yaml", ""}, FormatYAML},
+		{"YML extension", args{"refs.YML", ""}, FormatYAML},
+		{"TOML extension", args{"refs.toml", ""}, FormatTOML},
+		{"JSON content", args{"refs", "\n  {\"Srcs\":[]}"}, FormatJSON},
+		{"TOML table", args{"refs", "# comment\n[[Srcs]]\nName = \"a\""}, FormatTOML},
+		{"TOML key", args{"refs", "Include = [\"a.toml\"]"}, FormatTOML},
+		{"YAML content", args{"refs", "# comment\nSrcs:\n  - Name: a"}, FormatYAML},
+		{"Empty", args{"refs", ""}, FormatYAML},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refFormat(tt.args.refFile, []byte(tt.args.data)); got != tt.want {
+				t.Errorf("refFormat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportMatcher(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "pokervision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, src := range []string{"./testdata/seats.json",
+		"./testdata/structured.json"} {
+
+		m, err := NewMatcher(src)
+		if err != nil {
+			t.Fatalf("ExportMatcher() failed to load ref file. %v", err)
+		}
+		want := m.(*matcher)
+
+		tests := []struct {
+			name    string
+			format  RefFormat
+			refFile string
+		}{
+			{"JSON", FormatJSON, "refs.json"},
+			{"YAML", FormatYAML, "refs.yaml"},
+			{"TOML", FormatTOML, "refs.toml"},
+		}
+		for _, tt := range tests {
+			t.Run(src+" "+tt.name, func(t *testing.T) {
+				var buf bytes.Buffer
+				if err := ExportMatcher(&buf, m, tt.format); err != nil {
+					t.Fatalf("ExportMatcher() error = %v", err)
+				}
+
+				refFile := filepath.Join(dir, tt.refFile)
+				if err := ioutil.WriteFile(refFile, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+
+				got, err := NewMatcher(refFile)
+				if err != nil {
+					t.Fatalf("NewMatcher() error = %v", err)
+				}
+				if !reflect.DeepEqual(got.(*matcher).Srcs, want.Srcs) {
+					t.Errorf("ExportMatcher() srcs = %v, want %v",
+						got.(*matcher).Srcs, want.Srcs)
+				}
+				if !reflect.DeepEqual(got.(*matcher).Refs, want.Refs) {
+					t.Errorf("ExportMatcher() refs = %v, want %v",
+						got.(*matcher).Refs, want.Refs)
+				}
+			})
+		}
+	}
+
+	m := &matcher{}
+	if err := ExportMatcher(ioutil.Discard, m, RefFormat(42)); err == nil {
+		t.Errorf("ExportMatcher() error = nil, want error for unknown format")
+	}
+
+	// References held in memory have no file to refer to.
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	inMemory := []*MatcherBuilder{
+		NewMatcherBuilder().AddImage("ref", img, RefSpec{}),
+		NewMatcherBuilder().AddKNN("ref",
+			map[string][]image.Image{"a": {img}}, KNNOptions{}),
+	}
+	for _, b := range inMemory {
+		m, err := b.Build()
+		if err != nil {
+			t.Fatalf("ExportMatcher() failed to build matcher. %v", err)
+		}
+		if err := ExportMatcher(ioutil.Discard, m, FormatJSON); err == nil {
+			t.Errorf("ExportMatcher() error = nil, want error for in-memory reference")
+		}
+	}
+}
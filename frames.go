@@ -0,0 +1,480 @@
+package pokervision
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frame is a screenshot of a recorded session.
+type Frame struct {
+
+	// Name identifies the frame, usually by its file name.
+	Name string
+
+	// Image is the screenshot.
+	Image image.Image
+
+	// Time is when the frame was captured.
+	Time time.Time
+}
+
+// FrameSource reads the frames of a recorded session in order.
+type FrameSource interface {
+
+	// Next returns the next frame, or io.EOF after the last frame.
+	Next() (Frame, error)
+
+	// Close releases the recording.
+	Close() error
+}
+
+// FrameOptions configures the timestamps of frames.
+type FrameOptions struct {
+
+	// Start is the time of the first frame of recordings whose frames have
+	// no time of their own, like animated GIFs.
+	Start time.Time
+
+	// Interval is the time between frames. If it is positive, frame i is
+	// captured at Start plus i times Interval. Otherwise frames of
+	// directories and archives are captured at the modification time of
+	// their file, and frames of animated GIFs after the delay of the previous
+	// frame.
+	Interval time.Duration
+}
+
+// OpenFrames opens a recorded session, which is either a directory of
+// numbered PNG files, a zip or (gzipped) tar archive of numbered PNG files or
+// an animated GIF. PNG files are read in the order of the last number in their
+// name, other files are skipped.
+func OpenFrames(path string, opts FrameOptions) (FrameSource, error) {
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.IsDir() {
+		return openFrameDir(path, opts)
+	}
+
+	name := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return openFrameZip(path, opts)
+	case strings.HasSuffix(name, ".tar"), strings.HasSuffix(name, ".tar.gz"),
+		strings.HasSuffix(name, ".tgz"):
+		return openFrameTar(path, opts)
+	case strings.HasSuffix(name, ".gif"):
+		return openFrameGIF(path, opts)
+	}
+
+	return nil, fmt.Errorf("Unsupported recording %v", path)
+}
+
+// frameEntry is a frame which is decoded when it is read.
+type frameEntry struct {
+	name string
+	time time.Time
+	load func() (image.Image, error)
+}
+
+// entrySource implements FrameSource over a list of frames.
+type entrySource struct {
+	entries []frameEntry
+	next    int
+	closer  io.Closer
+}
+
+// newEntrySource sorts frames by number and assigns their timestamps.
+func newEntrySource(entries []frameEntry, opts FrameOptions,
+	sorted bool) *entrySource {
+
+	if !sorted {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return lessFrameName(entries[i].name, entries[j].name)
+		})
+	}
+
+	if opts.Interval > 0 {
+		for i := range entries {
+			entries[i].time = opts.Start.Add(time.Duration(i) * opts.Interval)
+		}
+	}
+
+	return &entrySource{entries: entries}
+}
+
+// Next returns the next frame.
+func (es *entrySource) Next() (Frame, error) {
+
+	if es.next >= len(es.entries) {
+		return Frame{}, io.EOF
+	}
+	e := es.entries[es.next]
+	es.next++
+
+	img, err := e.load()
+	if err != nil {
+		return Frame{}, fmt.Errorf("%v frame=%v", err, e.name)
+	}
+
+	return Frame{Name: e.name, Image: img, Time: e.time}, nil
+}
+
+// Close releases the recording.
+func (es *entrySource) Close() error {
+	if es.closer != nil {
+		return es.closer.Close()
+	}
+	return nil
+}
+
+// frameNumber matches the last number in a file name.
+var frameNumber = regexp.MustCompile(`(\d+)\D*$`)
+
+// lessFrameName orders file names by their last number, then by name.
+func lessFrameName(name1, name2 string) bool {
+
+	m1 := frameNumber.FindStringSubmatch(filepath.Base(name1))
+	m2 := frameNumber.FindStringSubmatch(filepath.Base(name2))
+	if m1 != nil && m2 != nil {
+		n1, _ := strconv.ParseUint(m1[1], 10, 64)
+		n2, _ := strconv.ParseUint(m2[1], 10, 64)
+		if n1 != n2 {
+			return n1 < n2
+		}
+	}
+
+	return name1 < name2
+}
+
+// isPNGFile reports whether a file name has the PNG extension.
+func isPNGFile(name string) bool {
+	return strings.ToLower(filepath.Ext(name)) == ".png"
+}
+
+// openFrameDir opens a directory of PNG files. Files are loaded through the
+// file loader.
+func openFrameDir(dir string, opts FrameOptions) (FrameSource, error) {
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []frameEntry
+	for _, fi := range files {
+		if fi.IsDir() || !isPNGFile(fi.Name()) {
+			continue
+		}
+
+		file := filepath.Join(dir, fi.Name())
+		entries = append(entries, frameEntry{
+			name: fi.Name(),
+			time: fi.ModTime(),
+			load: func() (image.Image, error) { return loadImage(file) },
+		})
+	}
+
+	return newEntrySource(entries, opts, false), nil
+}
+
+// openFrameZip opens a zip archive of PNG files.
+func openFrameZip(path string, opts FrameOptions) (FrameSource, error) {
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []frameEntry
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !isPNGFile(f.Name) {
+			continue
+		}
+
+		f := f
+		entries = append(entries, frameEntry{
+			name: f.Name,
+			time: f.Modified,
+			load: func() (image.Image, error) {
+				rc, err := f.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer rc.Close()
+				return png.Decode(rc)
+			},
+		})
+	}
+
+	es := newEntrySource(entries, opts, false)
+	es.closer = zr
+
+	return es, nil
+}
+
+// openFrameTar opens a tar archive of PNG files, which may be gzipped. Only
+// the headers are read when opening, the files are decoded from the archive as
+// their frame is read.
+func openFrameTar(path string, opts FrameOptions) (FrameSource, error) {
+
+	ta := &tarArchive{path: path}
+	if err := ta.open(); err != nil {
+		return nil, err
+	}
+
+	var entries []frameEntry
+	for {
+		hdr, err := ta.tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			ta.Close()
+			return nil, err
+		}
+		ta.pos++
+		if hdr.Typeflag != tar.TypeReg || !isPNGFile(hdr.Name) {
+			continue
+		}
+
+		index := ta.pos - 1
+		entries = append(entries, frameEntry{
+			name: hdr.Name,
+			time: hdr.ModTime,
+			load: func() (image.Image, error) { return ta.decode(index) },
+		})
+	}
+
+	es := newEntrySource(entries, opts, false)
+	es.closer = ta
+
+	return es, nil
+}
+
+// tarArchive reads the files of a tar archive. Tar archives can only be read
+// in order, so the archive is opened again to read a file stored before the
+// current position.
+type tarArchive struct {
+	path string
+
+	f  *os.File
+	gz *gzip.Reader
+	tr *tar.Reader
+
+	// pos is the number of headers read since the archive was opened.
+	pos int
+}
+
+// open opens the archive at its start.
+func (ta *tarArchive) open() error {
+
+	ta.Close()
+
+	f, err := os.Open(ta.path)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = f
+	if name := strings.ToLower(ta.path); strings.HasSuffix(name, ".gz") ||
+		strings.HasSuffix(name, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		ta.gz = gz
+		r = gz
+	}
+
+	ta.f, ta.tr, ta.pos = f, tar.NewReader(r), 0
+
+	return nil
+}
+
+// decode decodes the PNG file stored under the given header index.
+func (ta *tarArchive) decode(index int) (image.Image, error) {
+
+	if ta.tr == nil || index < ta.pos {
+		if err := ta.open(); err != nil {
+			return nil, err
+		}
+	}
+
+	for ta.pos <= index {
+		if _, err := ta.tr.Next(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		ta.pos++
+	}
+
+	return png.Decode(ta.tr)
+}
+
+// Close closes the archive.
+func (ta *tarArchive) Close() error {
+
+	var err error
+	if ta.gz != nil {
+		err = ta.gz.Close()
+	}
+	if ta.f != nil {
+		if cerr := ta.f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	ta.f, ta.gz, ta.tr = nil, nil, nil
+
+	return err
+}
+
+// openFrameGIF opens an animated GIF. The frames are composed as a viewer
+// shows them and are named "frame N", counting from 1. The GIF is decoded
+// when it is opened, but frames are only composed when they are read.
+func openFrameGIF(path string, opts FrameOptions) (FrameSource, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	g, err := gif.DecodeAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+
+	return &gifSource{g: g, opts: opts, canvas: image.NewRGBA(bounds),
+		t: opts.Start}, nil
+}
+
+// gifSource implements FrameSource for an animated GIF. Frames are composed
+// in order on a single canvas as they are read.
+type gifSource struct {
+	g    *gif.GIF
+	opts FrameOptions
+
+	canvas   *image.RGBA
+	previous *image.RGBA
+	next     int
+	t        time.Time
+}
+
+// Next composes and returns the next frame.
+func (gs *gifSource) Next() (Frame, error) {
+
+	if gs.next >= len(gs.g.Image) {
+		return Frame{}, io.EOF
+	}
+	i := gs.next
+	gs.next++
+
+	p := gs.g.Image[i]
+	bounds := gs.canvas.Bounds()
+
+	disposal := byte(0)
+	if i < len(gs.g.Disposal) {
+		disposal = gs.g.Disposal[i]
+	}
+	if disposal == gif.DisposalPrevious {
+		if gs.previous == nil {
+			gs.previous = image.NewRGBA(bounds)
+		}
+		draw.Draw(gs.previous, bounds, gs.canvas, image.Point{}, draw.Src)
+	}
+
+	draw.Draw(gs.canvas, p.Bounds(), p, p.Bounds().Min, draw.Over)
+
+	// The canvas changes with the next frame, so the frame gets a copy.
+	img := image.NewRGBA(bounds)
+	draw.Draw(img, bounds, gs.canvas, image.Point{}, draw.Src)
+
+	t := gs.t
+	if gs.opts.Interval > 0 {
+		t = gs.opts.Start.Add(time.Duration(i) * gs.opts.Interval)
+	}
+
+	switch disposal {
+	case gif.DisposalBackground:
+		draw.Draw(gs.canvas, p.Bounds(), image.Transparent, image.Point{},
+			draw.Src)
+	case gif.DisposalPrevious:
+		gs.canvas, gs.previous = gs.previous, gs.canvas
+	}
+
+	// Delays are in 100ths of a second.
+	if i < len(gs.g.Delay) {
+		gs.t = gs.t.Add(time.Duration(gs.g.Delay[i]) * 10 * time.Millisecond)
+	}
+
+	return Frame{Name: fmt.Sprintf("frame %v", i+1), Image: img, Time: t}, nil
+}
+
+// Close releases the recording.
+func (gs *gifSource) Close() error {
+	return nil
+}
+
+// Replay reads all frames of src and calls fn for each of them, waiting
+// between frames as long as their timestamps differ, divided by speed. A speed
+// of 2 replays twice as fast as recorded, a speed of 0 does not wait. Replay
+// stops at the first error of src or fn, and returns nil after the last frame.
+//
+// fn usually passes the frame to a matcher or a higher-level reader, e.g.
+//
+//	err := Replay(src, 1, func(f Frame) error {
+//		for _, h := range recorder.Frame(f.Image, f.Time) {
+//			h.WritePokerStars(os.Stdout)
+//		}
+//		return nil
+//	})
+func Replay(src FrameSource, speed float64, fn func(Frame) error) error {
+
+	var start time.Time
+	var first time.Time
+	for i := 0; ; i++ {
+		f, err := src.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if i == 0 {
+			start, first = time.Now(), f.Time
+		} else if speed > 0 {
+			due := start.Add(time.Duration(float64(f.Time.Sub(first)) / speed))
+			if wait := time.Until(due); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+}
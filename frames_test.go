@@ -0,0 +1,314 @@
+package pokervision
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// frameFiles are the files of a recording. Each PNG is as wide as the number
+// in its name.
+var frameFiles = []string{"frame-2.png", "frame-10.png", "frame-1.png",
+	"notes.txt"}
+
+// framePNG encodes a white PNG of the given width.
+func framePNG(t *testing.T, width int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, whiteImage(width, 1)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// writeFrameRecordings writes the frame files to a directory, a zip archive
+// and a gzipped tar archive in dir, with modification times one second apart
+// in the order of their number.
+func writeFrameRecordings(t *testing.T, dir string,
+	start time.Time) (frameDir, zipFile, tarFile string) {
+
+	frameDir = filepath.Join(dir, "frames")
+	if err := os.Mkdir(frameDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var zipBuf, tarBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	gw := gzip.NewWriter(&tarBuf)
+	tw := tar.NewWriter(gw)
+
+	for i, name := range frameFiles {
+		data := []byte("notes")
+		modTime := start
+		if isPNGFile(name) {
+			width := []int{2, 10, 1}[i]
+			data = framePNG(t, width)
+			modTime = start.Add(time.Duration(width) * time.Second)
+		}
+
+		file := filepath.Join(frameDir, name)
+		if err := ioutil.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name,
+			Modified: modTime, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644,
+			Size: int64(len(data)), ModTime: modTime,
+			Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(data)
+	}
+	zw.Close()
+	tw.Close()
+	gw.Close()
+
+	zipFile = filepath.Join(dir, "frames.zip")
+	tarFile = filepath.Join(dir, "frames.tar.gz")
+	if err := ioutil.WriteFile(zipFile, zipBuf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(tarFile, tarBuf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return frameDir, zipFile, tarFile
+}
+
+// readFrames reads all frames of a recording.
+func readFrames(t *testing.T, path string, opts FrameOptions) []Frame {
+
+	src, err := OpenFrames(path, opts)
+	if err != nil {
+		t.Fatalf("OpenFrames() error = %v", err)
+	}
+	defer src.Close()
+
+	var frames []Frame
+	for {
+		f, err := src.Next()
+		if err == io.EOF {
+			return frames
+		}
+		if err != nil {
+			t.Fatalf("FrameSource.Next() error = %v", err)
+		}
+		frames = append(frames, f)
+	}
+}
+
+func TestOpenFrames(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "pokervision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	frameDir, zipFile, tarFile := writeFrameRecordings(t, dir, start)
+
+	tests := []struct {
+		name  string
+		path  string
+		opts  FrameOptions
+		times []time.Duration
+	}{
+		{"Directory", frameDir, FrameOptions{},
+			[]time.Duration{time.Second, 2 * time.Second, 10 * time.Second}},
+		{"Directory interval", frameDir,
+			FrameOptions{Start: start, Interval: time.Second},
+			[]time.Duration{0, time.Second, 2 * time.Second}},
+		{"Zip", zipFile, FrameOptions{},
+			[]time.Duration{time.Second, 2 * time.Second, 10 * time.Second}},
+		{"Tar", tarFile, FrameOptions{Start: start, Interval: time.Minute},
+			[]time.Duration{0, time.Minute, 2 * time.Minute}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames := readFrames(t, tt.path, tt.opts)
+			if len(frames) != 3 {
+				t.Fatalf("OpenFrames() frames = %v, want 3", len(frames))
+			}
+
+			for i, f := range frames {
+				if got, want := f.Image.Bounds().Dx(), []int{1, 2, 10}[i]; got != want {
+					t.Errorf("frame %v width = %v, want %v", i, got, want)
+				}
+				if want := start.Add(tt.times[i]); !f.Time.Equal(want) {
+					t.Errorf("frame %v time = %v, want %v", i, f.Time, want)
+				}
+			}
+		})
+	}
+
+	if _, err := OpenFrames(filepath.Join(frameDir, "notes.txt"),
+		FrameOptions{}); err == nil {
+		t.Errorf("OpenFrames() expected error for unsupported file")
+	}
+	if _, err := OpenFrames(filepath.Join(dir, "missing"),
+		FrameOptions{}); err == nil {
+		t.Errorf("OpenFrames() expected error for missing file")
+	}
+}
+
+func TestOpenFrames_gif(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "pokervision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The second frame paints a single pixel over the first.
+	full := image.NewPaletted(image.Rect(0, 0, 4, 4), palette.Plan9)
+	for i := range full.Pix {
+		full.Pix[i] = uint8(full.Palette.Index(color.White))
+	}
+	dot := image.NewPaletted(image.Rect(1, 1, 2, 2), palette.Plan9)
+	dot.Pix[0] = uint8(dot.Palette.Index(color.Black))
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, &gif.GIF{
+		Image: []*image.Paletted{full, dot},
+		Delay: []int{50, 50},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "session.gif")
+	if err := ioutil.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	frames := readFrames(t, file, FrameOptions{Start: start})
+	if len(frames) != 2 {
+		t.Fatalf("OpenFrames() frames = %v, want 2", len(frames))
+	}
+
+	if got := []string{frames[0].Name, frames[1].Name}; !reflect.DeepEqual(got,
+		[]string{"frame 1", "frame 2"}) {
+		t.Errorf("frame names = %v", got)
+	}
+	if !frames[1].Time.Equal(start.Add(500 * time.Millisecond)) {
+		t.Errorf("frame 2 time = %v, want %v", frames[1].Time,
+			start.Add(500*time.Millisecond))
+	}
+
+	second := frames[1].Image
+	if second.Bounds() != image.Rect(0, 0, 4, 4) {
+		t.Errorf("frame 2 bounds = %v", second.Bounds())
+	}
+	if colorDelta(second.At(1, 1), color.Black) != 0 ||
+		colorDelta(second.At(0, 0), color.White) != 0 {
+		t.Errorf("frame 2 not composed over frame 1")
+	}
+	if colorDelta(frames[0].Image.At(1, 1), color.White) != 0 {
+		t.Errorf("frame 1 changed by frame 2")
+	}
+
+	// Disposing of the dot restores the frame before it.
+	dot2 := image.NewPaletted(image.Rect(2, 2, 3, 3), palette.Plan9)
+	dot2.Pix[0] = uint8(dot2.Palette.Index(color.Black))
+
+	buf.Reset()
+	if err := gif.EncodeAll(&buf, &gif.GIF{
+		Image:    []*image.Paletted{full, dot, dot2},
+		Delay:    []int{50, 50, 50},
+		Disposal: []byte{0, gif.DisposalPrevious, gif.DisposalBackground},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	frames = readFrames(t, file, FrameOptions{Start: start,
+		Interval: time.Second})
+	if len(frames) != 3 {
+		t.Fatalf("OpenFrames() frames = %v, want 3", len(frames))
+	}
+	if !frames[2].Time.Equal(start.Add(2 * time.Second)) {
+		t.Errorf("frame 3 time = %v, want %v", frames[2].Time,
+			start.Add(2*time.Second))
+	}
+	if colorDelta(frames[1].Image.At(1, 1), color.Black) != 0 ||
+		colorDelta(frames[2].Image.At(1, 1), color.White) != 0 ||
+		colorDelta(frames[2].Image.At(2, 2), color.Black) != 0 {
+		t.Errorf("frame 3 not composed over disposed frame 2")
+	}
+}
+
+// sliceFrames is a frame source reading frames from a slice.
+type sliceFrames []Frame
+
+func (sf *sliceFrames) Next() (Frame, error) {
+	if len(*sf) == 0 {
+		return Frame{}, io.EOF
+	}
+	f := (*sf)[0]
+	*sf = (*sf)[1:]
+	return f, nil
+}
+func (sf *sliceFrames) Close() error { return nil }
+
+func TestReplay(t *testing.T) {
+
+	start := time.Now()
+	frames := func() *sliceFrames {
+		return &sliceFrames{
+			{Name: "1", Time: start},
+			{Name: "2", Time: start.Add(100 * time.Millisecond)},
+			{Name: "3", Time: start.Add(200 * time.Millisecond)},
+		}
+	}
+
+	var names []string
+	begin := time.Now()
+	err := Replay(frames(), 10, func(f Frame) error {
+		names = append(names, f.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"1", "2", "3"}) {
+		t.Errorf("Replay() frames = %v", names)
+	}
+	if elapsed := time.Since(begin); elapsed < 20*time.Millisecond {
+		t.Errorf("Replay() took %v, want at least 20ms", elapsed)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = Replay(frames(), 0, func(f Frame) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("Replay() = %v after %v frames, want stop after 1", err,
+			calls)
+	}
+}
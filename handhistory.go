@@ -0,0 +1,724 @@
+package pokervision
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StreetPreflop is the street before the flop.
+const StreetPreflop = "preflop"
+
+// ActionKind is the kind of a hand action, worded as in hand histories.
+type ActionKind string
+
+// Kinds of hand actions.
+const (
+	ActionSmallBlind ActionKind = "posts small blind"
+	ActionBigBlind   ActionKind = "posts big blind"
+	ActionFold       ActionKind = "folds"
+	ActionCheck      ActionKind = "checks"
+	ActionCall       ActionKind = "calls"
+	ActionBet        ActionKind = "bets"
+	ActionRaise      ActionKind = "raises"
+	ActionCollect    ActionKind = "collected"
+
+	// ActionUncalled returns the part of a bet no other seat matched.
+	ActionUncalled ActionKind = "uncalled"
+)
+
+// HandAction is an action of a seat.
+type HandAction struct {
+	Street string
+	Seat   int
+	Kind   ActionKind
+
+	// Amount is the amount put in the pot, or collected from it. For raises
+	// it is the amount raised by.
+	Amount float64
+
+	// To is the total bet of the seat on the street after a raise.
+	To float64
+}
+
+// HandSeat is a seat taking part in a hand.
+type HandSeat struct {
+	Seat int
+	Name string
+
+	// Stack is the stack at the start of the hand.
+	Stack float64
+}
+
+// Hand is a hand reconstructed from consecutive frames.
+type Hand struct {
+	ID         int64
+	Time       time.Time
+	Table      string
+	MaxSeats   int
+	Button     int
+	SmallBlind float64
+	BigBlind   float64
+	Currency   string
+
+	Seats []HandSeat
+
+	// Hero is the seat of the hero, or 0. HoleCards are the cards of the hero.
+	Hero      int
+	HoleCards []string
+
+	Board   []string
+	Actions []HandAction
+}
+
+// HandHistoryOptions configures the hand histories written by a hand recorder.
+type HandHistoryOptions struct {
+
+	// Table is the name of the table.
+	Table string
+
+	// SmallBlind and BigBlind are the blinds. A seat whose first bet of a hand
+	// equals a blind posts it.
+	SmallBlind float64
+	BigBlind   float64
+
+	// Currency prefixes amounts, e.g. "$". Amounts are chips if it is empty.
+	Currency string
+
+	// FirstID is the number of the first hand. Later hands count up.
+	FirstID int64
+}
+
+// HandRecorder reconstructs hands from consecutive frames of a table.
+//
+// Hands start with the new hand events of an event stream, so the hand in
+// progress at the first frame is skipped. Players are named by the Name source
+// of their seat, or "Seat N". Bets are read as calls, bets and raises from the
+// change of the bet of a seat, folds from its Active source. Seats leaving
+// after the pot was awarded, or on the river without facing a bet, muck their
+// cards, and hands with more than one seat left go to showdown. Checks are not
+// visible and are inferred for the seats which did not act before a bet or
+// the end of a street. Increases of a stack are read as collecting the pot.
+// Cards must be named as in hand histories, e.g. "Ah" or "Td".
+type HandRecorder interface {
+
+	// Frame reads a frame captured at time t and returns the hands it
+	// completed.
+	Frame(img image.Image, t time.Time) []*Hand
+
+	// Close completes and returns the hand in progress, if any.
+	Close() *Hand
+}
+
+// NewHandRecorder creates a hand recorder reading the sources of layout with m.
+// The layout needs a Button source whose value is the number of the seat with
+// the dealer button. Values are stabilized as described by st.
+func NewHandRecorder(m Matcher, layout TableLayout, st Stability,
+	opts HandHistoryOptions) (HandRecorder, error) {
+
+	if layout.Button == "" {
+		return nil, errors.New("Hand recorder needs a button source")
+	}
+	if opts.SmallBlind <= 0 || opts.BigBlind <= 0 {
+		return nil, fmt.Errorf("Illegal blinds %v/%v", opts.SmallBlind,
+			opts.BigBlind)
+	}
+
+	return &handRecorder{
+		table:  newTableReader(m, layout, st),
+		opts:   opts,
+		nextID: opts.FirstID,
+	}, nil
+}
+
+// handRecorder implements HandRecorder.
+type handRecorder struct {
+	table  *tableReader
+	opts   HandHistoryOptions
+	nextID int64
+
+	// hand is the hand in progress, or nil.
+	hand *handState
+}
+
+// handState tracks the hand in progress.
+type handState struct {
+	*Hand
+	street    string
+	voluntary bool
+	active    map[int]bool
+	bets      map[int]float64
+	acted     map[int]bool
+	smallSeat int
+	bigSeat   int
+
+	// over tells if the pot was awarded.
+	over bool
+}
+
+// Frame reads a frame and returns the completed hands.
+func (hr *handRecorder) Frame(img image.Image, t time.Time) []*Hand {
+
+	events := hr.table.read(img, t)
+
+	// Pots are pushed to the winners while the next hand starts, so stacks
+	// changing in the frame starting a hand belong to the previous hand.
+	// Cards mucked then are not reported as folds.
+	newHand := len(events) > 0 && events[0].Kind == EventNewHand
+	if newHand && hr.hand != nil {
+		for _, e := range events {
+			if e.Kind == EventStackChanged {
+				hr.collect(e)
+			}
+		}
+	}
+
+	var done []*Hand
+	for _, e := range events {
+		switch {
+		case e.Kind == EventNewHand:
+			if h := hr.Close(); h != nil {
+				done = append(done, h)
+			}
+			hr.start(t)
+		case newHand && e.Kind == EventStackChanged:
+		case hr.hand != nil:
+			hr.hand.handle(e, &hr.opts)
+		}
+	}
+
+	return done
+}
+
+// collect records a stack growing in the frame starting a hand for the
+// previous hand. Blinds posted in the same frame are added back.
+func (hr *handRecorder) collect(e Event) {
+
+	was, ok1 := parseAmount(e.Old)
+	is, ok2 := parseAmount(e.New)
+	if !ok1 || !ok2 || !hr.hand.active[e.Seat] {
+		return
+	}
+
+	if bet := hr.table.layout.Seats[e.Seat-1].Bet; bet != "" {
+		posted, _ := parseAmount(hr.table.state[bet])
+		is += posted
+	}
+
+	if is > was {
+		hr.hand.Actions = append(hr.hand.Actions, HandAction{
+			Street: hr.hand.street, Seat: e.Seat, Kind: ActionCollect,
+			Amount: is - was})
+	}
+}
+
+// Close completes the hand in progress.
+func (hr *handRecorder) Close() *Hand {
+
+	if hr.hand == nil {
+		return nil
+	}
+	h := hr.hand
+	hr.hand = nil
+
+	h.inferChecks(0)
+	h.returnUncalled()
+
+	return h.Hand
+}
+
+// start starts a new hand from the current table state.
+func (hr *handRecorder) start(t time.Time) {
+
+	l := &hr.table.layout
+	state := hr.table.state
+
+	h := &handState{
+		Hand: &Hand{
+			ID:         hr.nextID,
+			Time:       t,
+			Table:      hr.opts.Table,
+			MaxSeats:   len(l.Seats),
+			SmallBlind: hr.opts.SmallBlind,
+			BigBlind:   hr.opts.BigBlind,
+			Currency:   hr.opts.Currency,
+			Hero:       l.Hero,
+		},
+		street: StreetPreflop,
+		active: make(map[int]bool),
+		bets:   make(map[int]float64),
+		acted:  make(map[int]bool),
+	}
+	hr.nextID++
+
+	h.Button, _ = strconv.Atoi(strings.TrimSpace(state[l.Button]))
+
+	for i, seat := range l.Seats {
+		if seat.Stack == "" || state[seat.Stack] == "" {
+			continue
+		}
+
+		// Bets of this frame are handled as events, so the stack before
+		// them is the stack plus the bet.
+		stack, _ := parseAmount(state[seat.Stack])
+		if seat.Bet != "" {
+			bet, _ := parseAmount(state[seat.Bet])
+			stack += bet
+		}
+
+		name := state[seat.Name]
+		if seat.Name == "" || name == "" {
+			name = fmt.Sprintf("Seat %v", i+1)
+		}
+
+		h.Seats = append(h.Seats, HandSeat{Seat: i + 1, Name: name,
+			Stack: stack})
+		h.active[i+1] = true
+	}
+
+	hr.hand = h
+}
+
+// handle updates the hand with an event.
+func (h *handState) handle(e Event, opts *HandHistoryOptions) {
+
+	if e.Kind != EventBoardDealt && e.Kind != EventCardsDealt &&
+		!h.active[e.Seat] {
+		return
+	}
+
+	switch e.Kind {
+	case EventCardsDealt:
+		if e.Seat == h.Hero && h.HoleCards == nil {
+			h.HoleCards = cardNames(e.Cards)
+		}
+
+	case EventFolded:
+		// Cards are mucked at showdown, once betting on the river is closed,
+		// and when the pot is pushed to the winner. Neither is a fold.
+		if h.over || h.street == StreetRiver && h.bets[e.Seat] >= h.level() {
+			return
+		}
+		h.act(HandAction{Seat: e.Seat, Kind: ActionFold})
+		h.active[e.Seat] = false
+
+	case EventBetChanged:
+		bet, _ := parseAmount(e.New)
+		if bet <= h.bets[e.Seat] {
+			// Bets are collected into the pot at the end of a street.
+			return
+		}
+		h.bet(e.Seat, bet, opts)
+
+	case EventStackChanged:
+		was, ok1 := parseAmount(e.Old)
+		is, ok2 := parseAmount(e.New)
+		if ok1 && ok2 && is > was {
+			h.Actions = append(h.Actions, HandAction{Street: h.street,
+				Seat: e.Seat, Kind: ActionCollect, Amount: is - was})
+			h.over = true
+		}
+
+	case EventBoardDealt:
+		h.inferChecks(0)
+		h.returnUncalled()
+		h.street = e.Street
+		h.Board = append(h.Board, cardNames(e.Cards)...)
+		h.bets = make(map[int]float64)
+		h.acted = make(map[int]bool)
+	}
+}
+
+// bet records a seat raising its bet on the street to bet.
+func (h *handState) bet(seat int, bet float64, opts *HandHistoryOptions) {
+
+	level := h.level()
+	amount := bet - h.bets[seat]
+
+	a := HandAction{Seat: seat, Amount: amount}
+	switch {
+	case !h.voluntary && h.bets[seat] == 0 && h.smallSeat == 0 &&
+		bet == opts.SmallBlind:
+		a.Kind = ActionSmallBlind
+		h.smallSeat = seat
+	case !h.voluntary && h.bets[seat] == 0 && h.bigSeat == 0 &&
+		bet == opts.BigBlind:
+		a.Kind = ActionBigBlind
+		h.bigSeat = seat
+	case bet <= level:
+		a.Kind = ActionCall
+	case level == 0:
+		h.inferChecks(seat)
+		a.Kind = ActionBet
+	default:
+		a.Kind = ActionRaise
+		a.Amount, a.To = bet-level, bet
+	}
+
+	h.bets[seat] = bet
+
+	if a.Kind == ActionSmallBlind || a.Kind == ActionBigBlind {
+		a.Street = h.street
+		h.Actions = append(h.Actions, a)
+		return
+	}
+	h.act(a)
+}
+
+// act records an action of a seat on the current street.
+func (h *handState) act(a HandAction) {
+	if a.Kind != ActionCheck {
+		h.voluntary = true
+	}
+	a.Street = h.street
+	h.Actions = append(h.Actions, a)
+	h.acted[a.Seat] = true
+}
+
+// level returns the highest bet on the street.
+func (h *handState) level() float64 {
+	var level float64
+	for _, bet := range h.bets {
+		if bet > level {
+			level = bet
+		}
+	}
+	return level
+}
+
+// inferChecks records checks for the active seats which did not act on the
+// street and whose bet is the highest, in the order of action up to seat
+// until. If until is 0, all seats are considered.
+func (h *handState) inferChecks(until int) {
+
+	level := h.level()
+	for _, seat := range h.actionOrder() {
+		if seat == until {
+			return
+		}
+		if h.active[seat] && !h.acted[seat] && h.bets[seat] == level {
+			h.act(HandAction{Seat: seat, Kind: ActionCheck})
+		}
+	}
+}
+
+// actionOrder returns the seats of the hand in the order of action on the
+// current street, starting after the big blind before the flop and after the
+// button on later streets.
+func (h *handState) actionOrder() []int {
+
+	first := h.Button
+	if h.street == StreetPreflop && h.bigSeat != 0 {
+		first = h.bigSeat
+	}
+
+	var before, after []int
+	for _, s := range h.Seats {
+		if s.Seat > first {
+			before = append(before, s.Seat)
+		} else {
+			after = append(after, s.Seat)
+		}
+	}
+
+	return append(before, after...)
+}
+
+// returnUncalled returns the part of the highest bet on the street which no
+// other seat matched.
+func (h *handState) returnUncalled() {
+
+	top, best, second := 0, 0.0, 0.0
+	for seat, bet := range h.bets {
+		if bet > best {
+			top, best, second = seat, bet, best
+		} else if bet > second {
+			second = bet
+		}
+	}
+	if top == 0 || best == second {
+		return
+	}
+
+	h.bets[top] = second
+	h.Actions = append(h.Actions, HandAction{Street: h.street, Seat: top,
+		Kind: ActionUncalled, Amount: best - second})
+}
+
+// Pot returns the total amount put in the pot.
+func (h *Hand) Pot() float64 {
+
+	var pot float64
+	street := StreetPreflop
+	bets := make(map[int]float64)
+	for _, a := range h.Actions {
+		if a.Street != street {
+			street = a.Street
+			bets = make(map[int]float64)
+		}
+
+		switch a.Kind {
+		case ActionSmallBlind, ActionBigBlind, ActionCall, ActionBet:
+			bets[a.Seat] += a.Amount
+			pot += a.Amount
+		case ActionRaise:
+			pot += a.To - bets[a.Seat]
+			bets[a.Seat] = a.To
+		case ActionUncalled:
+			pot -= a.Amount
+		}
+	}
+
+	return pot
+}
+
+// WritePokerStars writes the hand in the text format of PokerStars hand
+// histories, followed by two blank lines.
+func (h *Hand) WritePokerStars(w io.Writer) error {
+
+	names := make(map[int]string)
+	for _, s := range h.Seats {
+		names[s.Seat] = s.Name
+	}
+	amount := func(v float64) string {
+		return formatAmount(v, h.Currency)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "PokerStars Hand #%v: Hold'em No Limit (%v/%v) - %v\n",
+		h.ID, amount(h.SmallBlind), amount(h.BigBlind),
+		h.Time.Format("2006/01/02 15:04:05 MST"))
+	fmt.Fprintf(&b, "Table '%v' %v-max Seat #%v is the button\n", h.Table,
+		h.MaxSeats, h.Button)
+	for _, s := range h.Seats {
+		fmt.Fprintf(&b, "Seat %v: %v (%v in chips)\n", s.Seat, s.Name,
+			amount(s.Stack))
+	}
+
+	// The small blind is posted first.
+	for _, kind := range []ActionKind{ActionSmallBlind, ActionBigBlind} {
+		for _, a := range h.Actions {
+			if a.Kind == kind {
+				fmt.Fprintf(&b, "%v: %v %v\n", names[a.Seat], a.Kind,
+					amount(a.Amount))
+			}
+		}
+	}
+
+	for i, street := range handStreets {
+		if len(h.Board) < []int{0, 3, 4, 5}[i] {
+			break
+		}
+		writeStreetHeader(&b, h, street)
+
+		for _, a := range h.Actions {
+			if a.Street != street {
+				continue
+			}
+
+			switch a.Kind {
+			case ActionSmallBlind, ActionBigBlind, ActionCollect:
+			case ActionFold, ActionCheck:
+				fmt.Fprintf(&b, "%v: %v\n", names[a.Seat], a.Kind)
+			case ActionRaise:
+				fmt.Fprintf(&b, "%v: raises %v to %v\n", names[a.Seat],
+					amount(a.Amount), amount(a.To))
+			case ActionUncalled:
+				fmt.Fprintf(&b, "Uncalled bet (%v) returned to %v\n",
+					amount(a.Amount), names[a.Seat])
+			default:
+				fmt.Fprintf(&b, "%v: %v %v\n", names[a.Seat], a.Kind,
+					amount(a.Amount))
+			}
+		}
+	}
+
+	if h.showdown() {
+		b.WriteString("*** SHOW DOWN ***\n")
+	}
+
+	var won float64
+	for _, s := range h.Seats {
+		if v := h.won(s.Seat); v > 0 {
+			won += v
+			fmt.Fprintf(&b, "%v collected %v from pot\n", s.Name, amount(v))
+		}
+	}
+	var rake float64
+	if won > 0 && h.Pot() > won {
+		rake = h.Pot() - won
+	}
+
+	b.WriteString("*** SUMMARY ***\n")
+	fmt.Fprintf(&b, "Total pot %v | Rake %v\n", amount(h.Pot()), amount(rake))
+	if len(h.Board) > 0 {
+		fmt.Fprintf(&b, "Board [%v]\n", strings.Join(h.Board, " "))
+	}
+	for _, s := range h.Seats {
+		if line := h.summary(s.Seat); line != "" {
+			fmt.Fprintf(&b, "Seat %v: %v%v %v\n", s.Seat, s.Name,
+				h.position(s.Seat), line)
+		}
+	}
+	b.WriteString("\n\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// won returns the amount a seat collected from the pot. Stacks grow by the
+// uncalled bet and the pot collected, so the uncalled bet is subtracted.
+func (h *Hand) won(seat int) float64 {
+
+	var won float64
+	for _, a := range h.Actions {
+		if a.Seat != seat {
+			continue
+		}
+		switch a.Kind {
+		case ActionCollect:
+			won += a.Amount
+		case ActionUncalled:
+			won -= a.Amount
+		}
+	}
+
+	return won
+}
+
+// summary describes how a seat left the hand, or returns the empty string.
+func (h *Hand) summary(seat int) string {
+
+	if a, ok := h.fold(seat); ok {
+		if a.Street == StreetPreflop {
+			return "folded before Flop"
+		}
+		return "folded on the " + strings.ToUpper(a.Street[:1]) +
+			a.Street[1:]
+	}
+
+	if won := h.won(seat); won > 0 {
+		return fmt.Sprintf("collected (%v)", formatAmount(won, h.Currency))
+	}
+
+	if h.showdown() {
+		return "mucked"
+	}
+
+	return ""
+}
+
+// fold returns the fold of a seat. ok is false if the seat did not fold.
+func (h *Hand) fold(seat int) (a HandAction, ok bool) {
+	for _, a := range h.Actions {
+		if a.Seat == seat && a.Kind == ActionFold {
+			return a, true
+		}
+	}
+	return HandAction{}, false
+}
+
+// showdown tells if more than one seat was left at the end of the hand.
+func (h *Hand) showdown() bool {
+	left := 0
+	for _, s := range h.Seats {
+		if _, ok := h.fold(s.Seat); !ok {
+			left++
+		}
+	}
+	return left > 1
+}
+
+// position returns the position of a seat as written in summaries.
+func (h *Hand) position(seat int) string {
+	for _, a := range h.Actions {
+		if a.Seat == seat && a.Kind == ActionSmallBlind {
+			return " (small blind)"
+		}
+		if a.Seat == seat && a.Kind == ActionBigBlind {
+			return " (big blind)"
+		}
+	}
+	if seat == h.Button {
+		return " (button)"
+	}
+	return ""
+}
+
+// handStreets are the streets of a hand in order.
+var handStreets = []string{StreetPreflop, StreetFlop, StreetTurn, StreetRiver}
+
+// writeStreetHeader writes the header of a street. The board must hold the
+// cards of the street.
+func writeStreetHeader(b *strings.Builder, h *Hand, street string) {
+
+	switch street {
+	case StreetPreflop:
+		b.WriteString("*** HOLE CARDS ***\n")
+		if h.Hero != 0 && len(h.HoleCards) > 0 {
+			for _, s := range h.Seats {
+				if s.Seat == h.Hero {
+					fmt.Fprintf(b, "Dealt to %v [%v]\n", s.Name,
+						strings.Join(h.HoleCards, " "))
+				}
+			}
+		}
+	case StreetFlop:
+		fmt.Fprintf(b, "*** FLOP *** [%v]\n", strings.Join(h.Board[:3], " "))
+	case StreetTurn:
+		fmt.Fprintf(b, "*** TURN *** [%v] [%v]\n",
+			strings.Join(h.Board[:3], " "), h.Board[3])
+	case StreetRiver:
+		fmt.Fprintf(b, "*** RIVER *** [%v] [%v]\n",
+			strings.Join(h.Board[:4], " "), h.Board[4])
+	}
+}
+
+// parseAmount parses an amount read from the table, ignoring currency
+// symbols, thousands separators and other characters.
+func parseAmount(s string) (float64, bool) {
+
+	var digits strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' || r == '.' {
+			digits.WriteRune(r)
+		}
+	}
+
+	v, err := strconv.ParseFloat(digits.String(), 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return v, true
+}
+
+// formatAmount formats an amount. Amounts with a currency have two decimals,
+// unless they are whole.
+func formatAmount(v float64, currency string) string {
+
+	if currency == "" {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	return currency + strings.TrimSuffix(strconv.FormatFloat(v, 'f', 2, 64),
+		".00")
+}
+
+// cardNames returns cards as named in hand histories, with "10" as "T".
+func cardNames(cards []string) []string {
+
+	names := make([]string, len(cards))
+	for i, c := range cards {
+		if strings.HasPrefix(c, "10") {
+			c = "T" + c[2:]
+		}
+		names[i] = c
+	}
+
+	return names
+}
@@ -0,0 +1,318 @@
+package pokervision
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestNewHandRecorder(t *testing.T) {
+
+	layout := TableLayout{
+		Seats: []SeatLayout{
+			{Name: "s1name", Cards: []string{"s1c1", "s1c2"},
+				Stack: "s1stack", Bet: "s1bet", Active: "s1active"},
+			{Name: "s2name", Stack: "s2stack", Bet: "s2bet",
+				Active: "s2active"},
+			{Name: "s3name", Stack: "s3stack", Bet: "s3bet",
+				Active: "s3active"},
+		},
+		Hero:   1,
+		Board:  []string{"b1", "b2", "b3", "b4", "b5"},
+		Button: "button",
+	}
+
+	seats := map[string]string{"s1name": "Hero", "s2name": "Alice",
+		"s3name": "Bob"}
+	frame := func(values map[string]string) *tableFrame {
+		for k, v := range seats {
+			values[k] = v
+		}
+		return &tableFrame{values: values}
+	}
+
+	frames := []*tableFrame{
+		frame(map[string]string{"button": "3", "s1stack": "100",
+			"s2stack": "100", "s3stack": "100"}),
+		frame(map[string]string{"button": "1", "s1stack": "100",
+			"s2stack": "99", "s2bet": "1", "s3stack": "98", "s3bet": "2",
+			"s1active": "x", "s2active": "x", "s3active": "x",
+			"s1c1": "Ah", "s1c2": "Kd"}),
+		frame(map[string]string{"button": "1", "s1stack": "94", "s1bet": "6",
+			"s2stack": "99", "s2bet": "1", "s3stack": "98", "s3bet": "2",
+			"s1active": "x", "s2active": "x", "s3active": "x",
+			"s1c1": "Ah", "s1c2": "Kd"}),
+		frame(map[string]string{"button": "1", "s1stack": "94", "s1bet": "6",
+			"s2stack": "99", "s2bet": "1", "s3stack": "98", "s3bet": "2",
+			"s1active": "x", "s3active": "x", "s1c1": "Ah", "s1c2": "Kd"}),
+		frame(map[string]string{"button": "1", "s1stack": "94", "s1bet": "6",
+			"s2stack": "99", "s2bet": "1", "s3stack": "94", "s3bet": "6",
+			"s1active": "x", "s3active": "x", "s1c1": "Ah", "s1c2": "Kd"}),
+		frame(map[string]string{"button": "1", "s1stack": "94",
+			"s2stack": "99", "s3stack": "94", "s1active": "x",
+			"s3active": "x", "s1c1": "Ah", "s1c2": "Kd", "b1": "Qs",
+			"b2": "Jh", "b3": "7c"}),
+		frame(map[string]string{"button": "1", "s1stack": "84",
+			"s1bet": "10", "s2stack": "99", "s3stack": "94",
+			"s1active": "x", "s3active": "x", "s1c1": "Ah", "s1c2": "Kd",
+			"b1": "Qs", "b2": "Jh", "b3": "7c"}),
+		frame(map[string]string{"button": "1", "s1stack": "84",
+			"s1bet": "10", "s2stack": "99", "s3stack": "94",
+			"s1active": "x", "s1c1": "Ah", "s1c2": "Kd", "b1": "Qs",
+			"b2": "Jh", "b3": "7c"}),
+		frame(map[string]string{"button": "1", "s1stack": "84",
+			"s1bet": "10", "s2stack": "99", "s3stack": "94",
+			"s1active": "x", "s1c1": "Ah", "s1c2": "Kd", "b1": "Qs",
+			"b2": "Jh", "b3": "7c"}),
+		frame(map[string]string{"button": "2", "s1stack": "105",
+			"s1bet": "2", "s2stack": "99", "s3stack": "93", "s3bet": "1"}),
+	}
+
+	hr, err := NewHandRecorder(new(tableMatcher), layout, Stability{},
+		HandHistoryOptions{Table: "Test", SmallBlind: 1, BigBlind: 2,
+			FirstID: 100})
+	if err != nil {
+		t.Fatalf("NewHandRecorder() error = %v", err)
+	}
+
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	var hands []*Hand
+	for i, f := range frames {
+		hands = append(hands, hr.Frame(f, start.Add(time.Duration(i)*time.Second))...)
+	}
+	if len(hands) != 1 {
+		t.Fatalf("HandRecorder.Frame() hands = %v, want 1", len(hands))
+	}
+
+	var buf bytes.Buffer
+	if err := hands[0].WritePokerStars(&buf); err != nil {
+		t.Fatalf("Hand.WritePokerStars() error = %v", err)
+	}
+
+	want := `PokerStars Hand #100: Hold'em No Limit (1/2) - 2026/10/18 12:00:01 UTC
+Table 'Test' 3-max Seat #1 is the button
+Seat 1: Hero (100 in chips)
+Seat 2: Alice (100 in chips)
+Seat 3: Bob (100 in chips)
+Alice: posts small blind 1
+Bob: posts big blind 2
+*** HOLE CARDS ***
+Dealt to Hero [Ah Kd]
+Hero: raises 4 to 6
+Alice: folds
+Bob: calls 4
+*** FLOP *** [Qs Jh 7c]
+Bob: checks
+Hero: bets 10
+Bob: folds
+Uncalled bet (10) returned to Hero
+Hero collected 13 from pot
+*** SUMMARY ***
+Total pot 13 | Rake 0
+Board [Qs Jh 7c]
+Seat 1: Hero (button) collected (13)
+Seat 2: Alice (small blind) folded before Flop
+Seat 3: Bob (big blind) folded on the Flop
+
+
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Hand.WritePokerStars() = \n%v\nwant\n%v", got, want)
+	}
+
+	// The next hand is in progress.
+	h := hr.Close()
+	if h == nil || h.ID != 101 || h.Button != 2 || len(h.Actions) < 2 ||
+		h.Actions[0].Kind != ActionBigBlind || h.Actions[0].Seat != 1 ||
+		h.Actions[1].Kind != ActionSmallBlind || h.Actions[1].Seat != 3 ||
+		h.Seats[0].Stack != 107 {
+		t.Errorf("HandRecorder.Close() = %+v", h)
+	}
+	if h := hr.Close(); h != nil {
+		t.Errorf("HandRecorder.Close() = %+v, want nil", h)
+	}
+}
+
+func TestNewHandRecorder_errors(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		layout TableLayout
+		opts   HandHistoryOptions
+	}{
+		{"No button", TableLayout{}, HandHistoryOptions{SmallBlind: 1,
+			BigBlind: 2}},
+		{"No blinds", TableLayout{Button: "button"}, HandHistoryOptions{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewHandRecorder(new(tableMatcher), tt.layout,
+				Stability{}, tt.opts); err == nil {
+				t.Errorf("NewHandRecorder() expected error")
+			}
+		})
+	}
+}
+
+func Test_formatAmount(t *testing.T) {
+
+	tests := []struct {
+		in       string
+		currency string
+		want     string
+	}{
+		{"1,234", "", "1234"},
+		{"$0.5", "$", "$0.50"},
+		{"$2.00", "$", "$2"},
+		{"12.25 BB", "", "12.25"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			v, ok := parseAmount(tt.in)
+			if !ok {
+				t.Fatalf("parseAmount() failed")
+			}
+			if got := formatAmount(v, tt.currency); got != tt.want {
+				t.Errorf("formatAmount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewHandRecorder_showdown(t *testing.T) {
+
+	layout := TableLayout{
+		Seats: []SeatLayout{
+			{Name: "s1name", Cards: []string{"s1c1", "s1c2"},
+				Stack: "s1stack", Bet: "s1bet", Active: "s1active"},
+			{Name: "s2name", Stack: "s2stack", Bet: "s2bet",
+				Active: "s2active"},
+			{Name: "s3name", Stack: "s3stack", Bet: "s3bet",
+				Active: "s3active"},
+		},
+		Hero:   1,
+		Board:  []string{"b1", "b2", "b3", "b4", "b5"},
+		Button: "button",
+	}
+
+	base := map[string]string{"s1name": "Hero", "s2name": "Alice",
+		"s3name": "Bob", "button": "1", "s1c1": "Ah", "s1c2": "Kd",
+		"s1active": "x", "s2active": "x", "s3active": "x"}
+	board := map[string]string{"b1": "Qs", "b2": "Jh", "b3": "7c", "b4": "2s",
+		"b5": "9d"}
+
+	// frame returns a frame with the base values, the first cards of the
+	// board and the given values. Empty values remove base values.
+	frame := func(cards int, values map[string]string) *tableFrame {
+		all := make(map[string]string)
+		for k, v := range base {
+			all[k] = v
+		}
+		for i, b := range layout.Board[:cards] {
+			all[b] = board[layout.Board[i]]
+		}
+		for k, v := range values {
+			if v == "" {
+				delete(all, k)
+			} else {
+				all[k] = v
+			}
+		}
+		return &tableFrame{values: all}
+	}
+
+	frames := []*tableFrame{
+		frame(0, map[string]string{"button": "3", "s1stack": "100",
+			"s2stack": "100", "s3stack": "100", "s1c1": "", "s1c2": "",
+			"s1active": "", "s2active": "", "s3active": ""}),
+		frame(0, map[string]string{"s1stack": "100", "s2stack": "99",
+			"s2bet": "1", "s3stack": "98", "s3bet": "2"}),
+		frame(0, map[string]string{"s1stack": "98", "s1bet": "2",
+			"s2stack": "99", "s2bet": "1", "s3stack": "98", "s3bet": "2"}),
+		frame(0, map[string]string{"s1stack": "98", "s1bet": "2",
+			"s2stack": "99", "s2bet": "1", "s3stack": "98", "s3bet": "2",
+			"s2active": ""}),
+		frame(0, map[string]string{"s1stack": "98", "s1bet": "2",
+			"s2stack": "99", "s2bet": "1", "s3stack": "98", "s3bet": "2",
+			"s2active": ""}),
+		frame(3, map[string]string{"s1stack": "98", "s2stack": "99",
+			"s3stack": "98", "s2active": ""}),
+		frame(4, map[string]string{"s1stack": "98", "s2stack": "99",
+			"s3stack": "98", "s2active": ""}),
+		frame(5, map[string]string{"s1stack": "98", "s2stack": "99",
+			"s3stack": "98", "s2active": ""}),
+		frame(5, map[string]string{"s1stack": "98", "s2stack": "99",
+			"s3stack": "88", "s3bet": "10", "s2active": ""}),
+		frame(5, map[string]string{"s1stack": "88", "s1bet": "10",
+			"s2stack": "99", "s3stack": "88", "s3bet": "10", "s2active": ""}),
+		// Bob mucks, the pot is pushed to Hero, Hero's cards are cleared and
+		// only then the button moves.
+		frame(5, map[string]string{"s1stack": "88", "s2stack": "99",
+			"s3stack": "88", "s2active": "", "s3active": ""}),
+		frame(5, map[string]string{"s1stack": "113", "s2stack": "99",
+			"s3stack": "88", "s2active": "", "s3active": ""}),
+		frame(5, map[string]string{"s1stack": "113", "s2stack": "99",
+			"s3stack": "88", "s1c1": "", "s1c2": "", "s1active": "",
+			"s2active": "", "s3active": ""}),
+		frame(0, map[string]string{"button": "2", "s1stack": "113",
+			"s2stack": "99", "s3stack": "88", "s1c1": "", "s1c2": "",
+			"s1active": "", "s2active": "", "s3active": ""}),
+	}
+
+	hr, err := NewHandRecorder(new(tableMatcher), layout, Stability{},
+		HandHistoryOptions{Table: "Test", SmallBlind: 1, BigBlind: 2,
+			FirstID: 100})
+	if err != nil {
+		t.Fatalf("NewHandRecorder() error = %v", err)
+	}
+
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	var hands []*Hand
+	for i, f := range frames {
+		hands = append(hands, hr.Frame(f, start.Add(time.Duration(i)*time.Second))...)
+	}
+	if len(hands) != 1 {
+		t.Fatalf("HandRecorder.Frame() hands = %v, want 1", len(hands))
+	}
+
+	var buf bytes.Buffer
+	if err := hands[0].WritePokerStars(&buf); err != nil {
+		t.Fatalf("Hand.WritePokerStars() error = %v", err)
+	}
+
+	want := `PokerStars Hand #100: Hold'em No Limit (1/2) - 2026/10/18 12:00:01 UTC
+Table 'Test' 3-max Seat #1 is the button
+Seat 1: Hero (100 in chips)
+Seat 2: Alice (100 in chips)
+Seat 3: Bob (100 in chips)
+Alice: posts small blind 1
+Bob: posts big blind 2
+*** HOLE CARDS ***
+Dealt to Hero [Ah Kd]
+Hero: calls 2
+Alice: folds
+Bob: checks
+*** FLOP *** [Qs Jh 7c]
+Bob: checks
+Hero: checks
+*** TURN *** [Qs Jh 7c] [2s]
+Bob: checks
+Hero: checks
+*** RIVER *** [Qs Jh 7c 2s] [9d]
+Bob: bets 10
+Hero: calls 10
+*** SHOW DOWN ***
+Hero collected 25 from pot
+*** SUMMARY ***
+Total pot 25 | Rake 0
+Board [Qs Jh 7c 2s 9d]
+Seat 1: Hero (button) collected (25)
+Seat 2: Alice (small blind) folded before Flop
+Seat 3: Bob (big blind) mucked
+
+
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Hand.WritePokerStars() = \n%v\nwant\n%v", got, want)
+	}
+}
@@ -0,0 +1,248 @@
+package pokervision
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math"
+)
+
+// Histogram distance metrics. All distances are in the range [0, 1], where 0
+// means identical histograms.
+const (
+	// MetricIntersection is one minus the histogram intersection.
+	MetricIntersection = "intersection"
+
+	// MetricChiSquare is the chi-square distance.
+	MetricChiSquare = "chisquare"
+
+	// MetricBhattacharyya is the Bhattacharyya (Hellinger) distance.
+	MetricBhattacharyya = "bhattacharyya"
+)
+
+// defaultBins is the default number of histogram bins per color component.
+const defaultBins = 4
+
+// maxBins is the largest number of histogram bins per color component, which
+// keeps a histogram at 32^3 bins.
+const maxBins = 32
+
+// HistogramOptions configures histogram and dominant color references.
+type HistogramOptions struct {
+
+	// Bins is the number of bins per color component (1-32). The histogram
+	// has Bins^3 bins. Defaults to 4. The dominant color is the average color
+	// of the pixels in the fullest bin, so 1 bin compares the average color of
+	// the region.
+	Bins int `json:",omitempty" yaml:"Bins,omitempty" toml:",omitempty"`
+
+	// Metric is the distance metric of histogram references. Defaults to
+	// MetricIntersection.
+	Metric string `json:",omitempty" yaml:"Metric,omitempty" toml:",omitempty"`
+
+	// MaxDistance is the largest distance (0-1) between the histograms of
+	// region and reference image which is still considered a match.
+	MaxDistance float64 `json:",omitempty" yaml:"MaxDistance,omitempty" toml:",omitempty"`
+}
+
+// validate checks that the options are well-formed.
+func (o *HistogramOptions) validate() error {
+
+	if o.Bins < 0 || o.Bins > maxBins {
+		return fmt.Errorf("Illegal number of histogram bins %v", o.Bins)
+	}
+
+	switch o.Metric {
+	case "", MetricIntersection, MetricChiSquare, MetricBhattacharyya:
+	default:
+		return fmt.Errorf("Illegal histogram metric %v", o.Metric)
+	}
+
+	if o.MaxDistance < 0 || o.MaxDistance > 1 {
+		return fmt.Errorf("Illegal histogram distance %v", o.MaxDistance)
+	}
+
+	return nil
+}
+
+// bins returns the number of bins per color component.
+func (o *HistogramOptions) bins() int {
+	if o == nil || o.Bins == 0 {
+		return defaultBins
+	}
+	return o.Bins
+}
+
+// handleHistogram handles a comparison with a histogram or dominant color
+// reference.
+func handleHistogram(r *reference, srcImg image.Image) string {
+
+	spec, err := r.spec()
+	if err != nil {
+		log.Printf("error: %v refName=%v", err, r.Name)
+		return ""
+	}
+
+	match, _, err := compareHistogram(r, spec, srcImg)
+	if err != nil {
+		log.Printf("error: %v refName=%v", err, r.Name)
+		return ""
+	}
+
+	if match {
+		return r.result()
+	}
+
+	return ""
+}
+
+// compareHistogram compares a region against a histogram or dominant color
+// reference. For histogram references the distance between the histograms is
+// returned, for dominant color references the largest difference of a color
+// component.
+func compareHistogram(r *reference, spec RefSpec,
+	srcImg image.Image) (match bool, distance float64, err error) {
+
+	srcImg = preprocess(srcImg, spec.Preprocess)
+	bins := spec.Histogram.bins()
+
+	switch spec.Kind {
+	case RefHistogram:
+		refImg, err := r.loadImage(spec.File)
+		if err != nil {
+			return false, 0, err
+		}
+		refImg = preprocess(refImg, spec.Preprocess)
+
+		metric, maxDistance := MetricIntersection, 0.0
+		if spec.Histogram != nil {
+			if spec.Histogram.Metric != "" {
+				metric = spec.Histogram.Metric
+			}
+			maxDistance = spec.Histogram.MaxDistance
+		}
+
+		distance = histogramDistance(colorHistogram(refImg, bins),
+			colorHistogram(srcImg, bins), metric)
+
+		// Allow for rounding errors.
+		return distance <= maxDistance+1e-9, distance, nil
+
+	case RefDominant:
+		want, _ := parseHTMLColor(spec.Color)
+		got := dominantColor(srcImg, bins)
+
+		delta := maxUint32(absDiff(uint32(got.R), uint32(want.R)),
+			maxUint32(absDiff(uint32(got.G), uint32(want.G)),
+				absDiff(uint32(got.B), uint32(want.B))))
+
+		return delta <= uint32(spec.Tolerance), float64(delta), nil
+	}
+
+	return false, 0, fmt.Errorf("Not a histogram reference kind=%v", spec.Kind)
+}
+
+// binIndex returns the histogram bin of a color.
+func binIndex(c color.Color, bins int) int {
+	r, g, b, _ := c.RGBA()
+	ri := int(r>>8) * bins / 256
+	gi := int(g>>8) * bins / 256
+	bi := int(b>>8) * bins / 256
+	return (ri*bins+gi)*bins + bi
+}
+
+// colorHistogram computes the normalized color histogram of an image with
+// bins bins per color component. Transparent pixels are skipped.
+func colorHistogram(img image.Image, bins int) []float64 {
+
+	hist := make([]float64, bins*bins*bins)
+	total := 0
+
+	b := img.Bounds()
+	for x := b.Min.X; x < b.Max.X; x++ {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			c := img.At(x, y)
+			if _, _, _, a := c.RGBA(); a == 0 {
+				continue
+			}
+			hist[binIndex(c, bins)]++
+			total++
+		}
+	}
+
+	if total > 0 {
+		for i := range hist {
+			hist[i] /= float64(total)
+		}
+	}
+
+	return hist
+}
+
+// histogramDistance computes the distance between two normalized histograms.
+func histogramDistance(h1, h2 []float64, metric string) float64 {
+
+	var d float64
+	switch metric {
+	case MetricChiSquare:
+		for i := range h1 {
+			if sum := h1[i] + h2[i]; sum > 0 {
+				d += (h1[i] - h2[i]) * (h1[i] - h2[i]) / sum
+			}
+		}
+		return d / 2
+
+	case MetricBhattacharyya:
+		for i := range h1 {
+			d += math.Sqrt(h1[i] * h2[i])
+		}
+		return math.Sqrt(math.Max(0, 1-d))
+	}
+
+	for i := range h1 {
+		d += math.Min(h1[i], h2[i])
+	}
+	return math.Max(0, 1-d)
+}
+
+// dominantColor returns the average color of the pixels in the fullest bin of
+// the color histogram of an image. Transparent pixels are skipped.
+func dominantColor(img image.Image, bins int) color.RGBA {
+
+	type bin struct {
+		n       int
+		r, g, b uint64
+	}
+	hist := make([]bin, bins*bins*bins)
+
+	b := img.Bounds()
+	best := -1
+	for x := b.Min.X; x < b.Max.X; x++ {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A == 0 {
+				continue
+			}
+
+			i := binIndex(c, bins)
+			hist[i].n++
+			hist[i].r += uint64(c.R)
+			hist[i].g += uint64(c.G)
+			hist[i].b += uint64(c.B)
+
+			if best < 0 || hist[i].n > hist[best].n {
+				best = i
+			}
+		}
+	}
+
+	if best < 0 {
+		return color.RGBA{}
+	}
+
+	h := hist[best]
+	n := uint64(h.n)
+	return color.RGBA{uint8((h.r + n/2) / n), uint8((h.g + n/2) / n),
+		uint8((h.b + n/2) / n), 255}
+}
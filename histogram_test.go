@@ -0,0 +1,130 @@
+package pokervision
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestNewMatcher_histogram(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("NewMatcher() failed to load master image. %v", err)
+	}
+
+	m, err := NewMatcher("./testdata/histogram.json")
+	if err != nil {
+		t.Fatalf("NewMatcher() failed to load ref file. %v", err)
+	}
+
+	tests := []struct {
+		srcName string
+		wantRef string
+	}{
+		{"srcImg1", "refHistBlack"},
+		{"srcImg2", "refHistRed"},
+		{"srcImg3", "refDomBlack"},
+		{"srcImg4", "refDomRed"},
+		{"srcImg5", "refAvg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.srcName, func(t *testing.T) {
+			if got := m.Match(tt.srcName, img); got != tt.wantRef {
+				t.Errorf("matcher.Match() = %v, want %v", got, tt.wantRef)
+			}
+		})
+	}
+}
+
+func Test_histogramDistance(t *testing.T) {
+
+	half := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	half.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	half.Set(1, 0, color.RGBA{0, 0, 255, 255})
+
+	red := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	red.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	red.Set(1, 0, color.RGBA{250, 10, 10, 255})
+
+	blue := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	blue.Set(0, 0, color.RGBA{0, 0, 255, 255})
+
+	tests := []struct {
+		name   string
+		img1   image.Image
+		img2   image.Image
+		metric string
+		want   float64
+	}{
+		{"Identical", red, red, MetricIntersection, 0},
+		{"Intersection", half, red, MetricIntersection, 0.5},
+		{"Intersection disjoint", red, blue, MetricIntersection, 1},
+		{"Chi-square", half, red, MetricChiSquare, 1.0 / 3},
+		{"Chi-square disjoint", red, blue, MetricChiSquare, 1},
+		{"Bhattacharyya", half, red, MetricBhattacharyya,
+			math.Sqrt(1 - math.Sqrt(0.5))},
+		{"Bhattacharyya disjoint", red, blue, MetricBhattacharyya, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := histogramDistance(colorHistogram(tt.img1, defaultBins),
+				colorHistogram(tt.img2, defaultBins), tt.metric)
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("histogramDistance() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_dominantColor(t *testing.T) {
+
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	img.Set(0, 0, color.NRGBA{200, 0, 0, 255})
+	img.Set(1, 0, color.NRGBA{210, 10, 0, 255})
+	img.Set(2, 0, color.NRGBA{0, 0, 100, 255})
+	img.Set(3, 0, color.NRGBA{0, 0, 0, 0})
+
+	tests := []struct {
+		name string
+		bins int
+		want color.RGBA
+	}{
+		{"Fullest bin", 4, color.RGBA{205, 5, 0, 255}},
+		{"Average", 1, color.RGBA{137, 3, 33, 255}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dominantColor(img, tt.bins); got != tt.want {
+				t.Errorf("dominantColor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistogramOptions_validate(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		opts    HistogramOptions
+		wantErr bool
+	}{
+		{"Defaults", HistogramOptions{}, false},
+		{"Valid", HistogramOptions{Bins: 8, Metric: MetricChiSquare,
+			MaxDistance: 0.2}, false},
+		{"Most bins", HistogramOptions{Bins: 32}, false},
+		{"Too many bins", HistogramOptions{Bins: 33}, true},
+		{"Negative bins", HistogramOptions{Bins: -1}, true},
+		{"Unknown metric", HistogramOptions{Metric: "euclid"}, true},
+		{"Distance out of range", HistogramOptions{MaxDistance: 1.5}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("HistogramOptions.validate() error = %v, wantErr %v",
+					err, tt.wantErr)
+			}
+		})
+	}
+}
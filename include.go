@@ -0,0 +1,102 @@
+package pokervision
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// loadRefFile loads a JSON, YAML or TOML encoded ref file. The files listed in Include are
+// loaded first, in order, through the file loader. Sources and references
+// defined later replace earlier ones of the same name. parents holds the
+// files currently being included, which is used to detect cycles.
+func loadRefFile(refFile string, parents []string) (*matcher, error) {
+
+	for _, p := range parents {
+		if p == refFile {
+			return nil, fmt.Errorf("Include cycle refFile=%v", refFile)
+		}
+	}
+
+	// Read file containing references.
+	reader := fileLoader.Load(refFile)
+	if reader == nil {
+		return nil, errors.New("Failed to load ref file")
+	}
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(reader)
+
+	// Fill data from file into matcher.
+	var m matcher
+	err := unmarshalRefs(refFile, buf.Bytes(), &m)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve includes.
+	parents = append(append([]string(nil), parents...), refFile)
+	merged := new(matcher)
+	for _, inc := range m.Include {
+		im, err := loadRefFile(inc, parents)
+		if err != nil {
+			return nil, fmt.Errorf("%v include=%v", err, inc)
+		}
+		merged.merge(im)
+	}
+	merged.merge(&m)
+	merged.refFiles = append(merged.refFiles, refFile)
+
+	return merged, nil
+}
+
+// merge adds the sources, references, templates and ref files of other to the
+// matcher.
+// A source, reference or template replaces an existing one of the same name in
+// place. Template instances are appended.
+func (im *matcher) merge(other *matcher) {
+
+	for _, t := range other.Templates {
+		replaced := false
+		for i := range im.Templates {
+			if im.Templates[i].Name == t.Name {
+				im.Templates[i] = t
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			im.Templates = append(im.Templates, t)
+		}
+	}
+
+	im.Instances = append(im.Instances, other.Instances...)
+	im.refFiles = append(im.refFiles, other.refFiles...)
+
+	for _, s := range other.Srcs {
+		replaced := false
+		for i := range im.Srcs {
+			if im.Srcs[i].Name == s.Name {
+				im.Srcs[i] = s
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			im.Srcs = append(im.Srcs, s)
+		}
+	}
+
+	for _, r := range other.Refs {
+		replaced := false
+		for i := range im.Refs {
+			if im.Refs[i].Name == r.Name {
+				im.Refs[i] = r
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			im.Refs = append(im.Refs, r)
+		}
+	}
+}
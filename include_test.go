@@ -0,0 +1,73 @@
+package pokervision
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_loadRefFile(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("loadRefFile() failed to load master image. %v", err)
+	}
+
+	type args struct {
+		refFile string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{"Valid", args{"./testdata/included.json"}, false},
+		{"Cycle", args{"./testdata/includeCycle.json"}, true},
+		{"Missing include", args{"./testdata/includeMissing.json"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := loadRefFile(tt.args.refFile, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadRefFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if len(m.Refs) != 4 || len(m.Srcs) != 2 || m.Include != nil {
+				t.Errorf("loadRefFile() = %+v, want 4 refs and 2 sources", m)
+			}
+			if got := m.Match("srcImg1", img); got != "refImg2" {
+				t.Errorf("matcher.Match() = %v, want refImg2", got)
+			}
+			if got := m.Match("srcColor1", img); got != "refColor2" {
+				t.Errorf("matcher.Match() = %v, want refColor2", got)
+			}
+		})
+	}
+}
+
+func Test_matcher_merge(t *testing.T) {
+
+	im := &matcher{
+		Srcs: []source{{Name: "s1", Src: []int{1, 2}}, {Name: "s2"}},
+		Refs: []reference{{Name: "r1", Ref: "color:#000000"}},
+	}
+	other := &matcher{
+		Srcs: []source{{Name: "s1", Src: []int{3, 4}}, {Name: "s3"}},
+		Refs: []reference{{Name: "r2"}, {Name: "r1", Ref: "color:#ffffff"}},
+	}
+
+	im.merge(other)
+
+	wantSrcs := []source{{Name: "s1", Src: []int{3, 4}}, {Name: "s2"},
+		{Name: "s3"}}
+	wantRefs := []reference{{Name: "r1", Ref: "color:#ffffff"}, {Name: "r2"}}
+
+	if !reflect.DeepEqual(im.Srcs, wantSrcs) {
+		t.Errorf("matcher.merge() srcs = %v, want %v", im.Srcs, wantSrcs)
+	}
+	if !reflect.DeepEqual(im.Refs, wantRefs) {
+		t.Errorf("matcher.merge() refs = %v, want %v", im.Refs, wantRefs)
+	}
+}
@@ -0,0 +1,406 @@
+package pokervision
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"sort"
+
+	"github.com/nfnt/resize"
+)
+
+// Feature vectors of kNN references.
+const (
+	// FeatureGray is the downscaled grayscale image, normalized to zero mean
+	// and unit variance, which makes it independent of brightness and
+	// contrast.
+	FeatureGray = "gray"
+
+	// FeatureGradient is a histogram of gradient orientations for each cell
+	// of 4x4 pixels of the downscaled image, similar to HOG.
+	FeatureGradient = "gradient"
+)
+
+// Defaults of kNN references.
+const (
+	defaultK       = 3
+	defaultKNNSize = 16
+)
+
+// KNNOptions configures kNN references, which classify a region by the labels
+// of the most similar example images.
+type KNNOptions struct {
+
+	// Examples are the example images of each label.
+	Examples []KNNExample `json:",omitempty" yaml:"Examples,omitempty" toml:",omitempty"`
+
+	// K is the number of nearest examples voting for a label. Defaults to 3.
+	K int `json:",omitempty" yaml:"K,omitempty" toml:",omitempty"`
+
+	// Features is the feature vector compared, FeatureGray or
+	// FeatureGradient. Defaults to FeatureGray.
+	Features string `json:",omitempty" yaml:"Features,omitempty" toml:",omitempty"`
+
+	// Size is the width and height (4-64) images are scaled to before
+	// features are computed. Defaults to 16.
+	Size int `json:",omitempty" yaml:"Size,omitempty" toml:",omitempty"`
+
+	// MinConfidence is the smallest fraction (0-1) of the K nearest examples
+	// which must vote for the label for the reference to match.
+	MinConfidence float64 `json:",omitempty" yaml:"MinConfidence,omitempty" toml:",omitempty"`
+}
+
+// KNNExample lists the example images of a label.
+type KNNExample struct {
+	Label string   `yaml:"Label"`
+	Files []string `yaml:"Files"`
+}
+
+// validate checks that the options are well-formed. hasModel tells if the
+// examples are held in memory, in which case no files are needed.
+func (o *KNNOptions) validate(hasModel bool) error {
+
+	if o == nil {
+		if hasModel {
+			return nil
+		}
+		return errors.New("kNN reference without examples")
+	}
+
+	files := 0
+	for _, e := range o.Examples {
+		if e.Label == "" {
+			return errors.New("kNN example without label")
+		}
+		files += len(e.Files)
+	}
+	if files == 0 && !hasModel {
+		return errors.New("kNN reference without examples")
+	}
+
+	if o.K < 0 {
+		return fmt.Errorf("Illegal k %v", o.K)
+	}
+
+	switch o.Features {
+	case "", FeatureGray, FeatureGradient:
+	default:
+		return fmt.Errorf("Illegal kNN features %v", o.Features)
+	}
+
+	if o.Size != 0 && (o.Size < 4 || o.Size > 64) {
+		return fmt.Errorf("Illegal kNN size %v", o.Size)
+	}
+
+	if o.MinConfidence < 0 || o.MinConfidence > 1 {
+		return fmt.Errorf("Illegal kNN confidence %v", o.MinConfidence)
+	}
+
+	return nil
+}
+
+// k returns the number of voting examples.
+func (o *KNNOptions) k() int {
+	if o == nil || o.K == 0 {
+		return defaultK
+	}
+	return o.K
+}
+
+// size returns the size images are scaled to.
+func (o *KNNOptions) size() int {
+	if o == nil || o.Size == 0 {
+		return defaultKNNSize
+	}
+	return o.Size
+}
+
+// features returns the kind of feature vector.
+func (o *KNNOptions) features() string {
+	if o == nil || o.Features == "" {
+		return FeatureGray
+	}
+	return o.Features
+}
+
+// knnModel holds the feature vectors of the examples of a kNN reference.
+type knnModel struct {
+	labels  []string
+	vectors [][]float64
+}
+
+// newKNNModel computes the feature vectors of example images, given by label,
+// as described by the definition of a kNN reference.
+func newKNNModel(examples map[string][]image.Image, spec RefSpec) *knnModel {
+
+	labels := make([]string, 0, len(examples))
+	for label := range examples {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	model := new(knnModel)
+	for _, label := range labels {
+		for _, img := range examples[label] {
+			model.labels = append(model.labels, label)
+			model.vectors = append(model.vectors,
+				featureVector(preprocess(img, spec.Preprocess), spec.KNN))
+		}
+	}
+
+	return model
+}
+
+// loadKNNModel loads the example images of a kNN reference and computes their
+// feature vectors.
+func loadKNNModel(spec RefSpec) (*knnModel, error) {
+
+	examples := make(map[string][]image.Image)
+	for _, e := range spec.KNN.Examples {
+		for _, file := range e.Files {
+			img, err := loadImage(file)
+			if err != nil {
+				return nil, fmt.Errorf("%v label=%v", err, e.Label)
+			}
+			examples[e.Label] = append(examples[e.Label], img)
+		}
+	}
+
+	return newKNNModel(examples, spec), nil
+}
+
+// loadKNNModels loads the examples of all kNN references and computes their
+// feature vectors once, instead of on every match. Invalid references are
+// skipped and reported when they are matched.
+func (im *matcher) loadKNNModels() error {
+
+	for i := range im.Refs {
+		r := &im.Refs[i]
+
+		spec, err := r.spec()
+		if err != nil || spec.Kind != RefKNN || r.knn != nil {
+			continue
+		}
+
+		if r.knn, err = loadKNNModel(spec); err != nil {
+			return fmt.Errorf("%v refName=%v", err, r.Name)
+		}
+	}
+
+	return nil
+}
+
+// loadKNN returns the model of a kNN reference, loading the examples if they
+// are not held in memory.
+func (r *reference) loadKNN(spec RefSpec) (*knnModel, error) {
+	if r.knn != nil {
+		return r.knn, nil
+	}
+	return loadKNNModel(spec)
+}
+
+// classify returns the label most of the k nearest examples have and the
+// fraction of them voting for it. Ties go to the label of the nearest
+// example.
+func (model *knnModel) classify(vector []float64, k int) (label string,
+	confidence float64) {
+
+	if len(model.vectors) == 0 {
+		return "", 0
+	}
+
+	order := make([]int, len(model.vectors))
+	dists := make([]float64, len(model.vectors))
+	for i, v := range model.vectors {
+		order[i] = i
+		dists[i] = vectorDistance(vector, v)
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return dists[order[a]] < dists[order[b]]
+	})
+
+	if k > len(order) {
+		k = len(order)
+	}
+
+	votes := make(map[string]int)
+	for _, i := range order[:k] {
+		votes[model.labels[i]]++
+	}
+
+	// Nearest examples come first, so they win ties.
+	for _, i := range order[:k] {
+		if l := model.labels[i]; label == "" || votes[l] > votes[label] {
+			label = l
+		}
+	}
+
+	return label, float64(votes[label]) / float64(k)
+}
+
+// handleKNN handles a classification with a kNN reference. The label is
+// returned if enough of the nearest examples vote for it.
+func handleKNN(r *reference, srcImg image.Image) string {
+
+	label, confidence, err := classifyKNN(r, srcImg)
+	if err != nil {
+		log.Printf("error: %v refName=%v", err, r.Name)
+		return ""
+	}
+
+	spec, _ := r.spec()
+	if !knnConfident(spec, confidence) {
+		return ""
+	}
+
+	return label
+}
+
+// knnConfident reports whether a kNN reference is confident enough of a
+// label.
+func knnConfident(spec RefSpec, confidence float64) bool {
+
+	// Allow for rounding errors.
+	return spec.KNN == nil || confidence >= spec.KNN.MinConfidence-1e-9
+}
+
+// classifyKNN classifies a region with a kNN reference.
+func classifyKNN(r *reference, srcImg image.Image) (label string,
+	confidence float64, err error) {
+
+	spec, err := r.spec()
+	if err != nil {
+		return "", 0, err
+	}
+
+	model, err := r.loadKNN(spec)
+	if err != nil {
+		return "", 0, err
+	}
+
+	vector := featureVector(preprocess(srcImg, spec.Preprocess), spec.KNN)
+	label, confidence = model.classify(vector, spec.KNN.k())
+
+	return label, confidence, nil
+}
+
+// featureVector computes the feature vector of an image.
+func featureVector(img image.Image, opts *KNNOptions) []float64 {
+
+	size := opts.size()
+	scaled := resize.Resize(uint(size), uint(size), img, resize.Bilinear)
+
+	// Compute luminance.
+	b := scaled.Bounds()
+	lum := make([]float64, size*size)
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			r, g, bl, _ := scaled.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			lum[y*size+x] = float64((19595*r+38470*g+7471*bl+1<<15)>>16) / 65535
+		}
+	}
+
+	if opts.features() == FeatureGradient {
+		return gradientFeatures(lum, size)
+	}
+
+	return normalize(lum)
+}
+
+// normalize scales a vector to zero mean and unit variance. A constant vector
+// becomes all zeros.
+func normalize(v []float64) []float64 {
+
+	var mean float64
+	for _, x := range v {
+		mean += x
+	}
+	mean /= float64(len(v))
+
+	var variance float64
+	for _, x := range v {
+		variance += (x - mean) * (x - mean)
+	}
+	std := math.Sqrt(variance / float64(len(v)))
+
+	out := make([]float64, len(v))
+	for i, x := range v {
+		if std > 1e-9 {
+			out[i] = (x - mean) / std
+		}
+	}
+
+	return out
+}
+
+// gradientFeatures computes a histogram of 8 unsigned gradient orientations
+// for each cell of 4x4 pixels of a square luminance image, weighted by the
+// gradient magnitude. The vector is scaled to unit length.
+func gradientFeatures(lum []float64, size int) []float64 {
+
+	const cell, bins = 4, 8
+	cells := (size + cell - 1) / cell
+	v := make([]float64, cells*cells*bins)
+
+	at := func(x, y int) float64 {
+		if x < 0 {
+			x = 0
+		} else if x >= size {
+			x = size - 1
+		}
+		if y < 0 {
+			y = 0
+		} else if y >= size {
+			y = size - 1
+		}
+		return lum[y*size+x]
+	}
+
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			gx := at(x+1, y) - at(x-1, y)
+			gy := at(x, y+1) - at(x, y-1)
+
+			mag := math.Hypot(gx, gy)
+			if mag == 0 {
+				continue
+			}
+
+			angle := math.Atan2(gy, gx)
+			if angle < 0 {
+				angle += math.Pi
+			}
+			bin := int(angle / math.Pi * bins)
+			if bin >= bins {
+				bin = bins - 1
+			}
+
+			v[((y/cell)*cells+x/cell)*bins+bin] += mag
+		}
+	}
+
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm = math.Sqrt(norm); norm > 0 {
+		for i := range v {
+			v[i] /= norm
+		}
+	}
+
+	return v
+}
+
+// vectorDistance returns the Euclidean distance between two vectors.
+func vectorDistance(v1, v2 []float64) float64 {
+
+	var d float64
+	for i := range v1 {
+		d += (v1[i] - v2[i]) * (v1[i] - v2[i])
+	}
+
+	return math.Sqrt(d)
+}
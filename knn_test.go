@@ -0,0 +1,202 @@
+package pokervision
+
+import (
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewMatcher_knn(t *testing.T) {
+
+	m, err := NewMatcher("./testdata/knn.json")
+	if err != nil {
+		t.Fatalf("NewMatcher() failed to load ref file. %v", err)
+	}
+
+	tests := []struct {
+		file          string
+		want          string
+		wantConfident string
+	}{
+		{"./testdata/lightNum2.png", "number", ""},
+		{"./testdata/darkNum2.png", "number", ""},
+		{"./testdata/pot.png", "number", ""},
+		{"./testdata/lightText2.png", "text", ""},
+		{"./testdata/darkText2.png", "text", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			img, err := loadImage(tt.file)
+			if err != nil {
+				t.Fatalf("matcher.Match() failed to load test file. %v", err)
+			}
+
+			if got := m.Match("src", img); got != tt.want {
+				t.Errorf("matcher.Match() = %v, want %v", got, tt.want)
+			}
+			if got := m.Match("srcConfident", img); got != tt.wantConfident {
+				t.Errorf("matcher.Match() = %v, want %v", got, tt.wantConfident)
+			}
+		})
+	}
+}
+
+func TestNewMatcher_knnModels(t *testing.T) {
+
+	m, err := loadMatcher("./testdata/knn.json")
+	if err != nil {
+		t.Fatalf("NewMatcher() failed to load ref file. %v", err)
+	}
+
+	// The examples are loaded once, with the ref file.
+	for _, r := range m.Refs {
+		if r.knn == nil || len(r.knn.vectors) != 4 {
+			t.Errorf("loadMatcher() did not load the examples refName=%v", r.Name)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "pokervision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	refFile := filepath.Join(dir, "refs.json")
+	refs := `{"Refs":[{"Name":"ref","Kind":"knn","KNN":{"Examples":[
+		{"Label":"a","Files":["./testdata/noExist.png"]}]}}]}`
+	if err := ioutil.WriteFile(refFile, []byte(refs), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMatcher(refFile); err == nil {
+		t.Errorf("NewMatcher() error = nil, want error for missing example")
+	}
+}
+
+// stripes creates an image of black and white stripes, which are horizontal
+// or vertical.
+func stripes(width, height, period int, vertical bool) image.Image {
+
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			i := y
+			if vertical {
+				i = x
+			}
+			if i/period%2 == 0 {
+				img.SetGray(x, y, color.Gray{255})
+			}
+		}
+	}
+
+	return img
+}
+
+func TestMatcherBuilder_AddKNN(t *testing.T) {
+
+	examples := map[string][]image.Image{
+		"horizontal": {stripes(32, 32, 4, false), stripes(24, 32, 3, false)},
+		"vertical":   {stripes(32, 32, 4, true), stripes(32, 24, 3, true)},
+	}
+
+	m, err := NewMatcherBuilder().
+		AddRegion("src", image.Rect(0, 0, 64, 64), "stripes").
+		AddKNN("stripes", examples, KNNOptions{K: 3,
+			Features: FeatureGradient}).
+		Classify("src", 0).
+		Build()
+	if err != nil {
+		t.Fatalf("MatcherBuilder.Build() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		img  image.Image
+		want string
+	}{
+		{"Horizontal", stripes(40, 30, 5, false), "horizontal"},
+		{"Vertical", stripes(30, 40, 5, true), "vertical"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.Match("src", tt.img); got != tt.want {
+				t.Errorf("matcher.Match() = %v, want %v", got, tt.want)
+			}
+
+			c, err := Classify(m, "src", tt.img)
+			if err != nil {
+				t.Fatalf("Classify() error = %v", err)
+			}
+			if math.Abs(c.Best.Score-2.0/3) > 1e-9 {
+				t.Errorf("Classify() score = %v, want 2/3", c.Best.Score)
+			}
+		})
+	}
+}
+
+func Test_knnModel_classify(t *testing.T) {
+
+	model := &knnModel{
+		labels:  []string{"a", "b", "b", "a"},
+		vectors: [][]float64{{0}, {1}, {2}, {10}},
+	}
+
+	tests := []struct {
+		name           string
+		vector         []float64
+		k              int
+		wantLabel      string
+		wantConfidence float64
+	}{
+		{"Nearest", []float64{0.2}, 1, "a", 1},
+		{"Majority", []float64{0.2}, 3, "b", 2.0 / 3},
+		{"Tie goes to nearest", []float64{1.6}, 2, "b", 1},
+		{"Tie", []float64{0.4}, 2, "a", 0.5},
+		{"K larger than examples", []float64{9}, 10, "a", 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			label, confidence := model.classify(tt.vector, tt.k)
+			if label != tt.wantLabel || math.Abs(confidence-tt.wantConfidence) > 1e-9 {
+				t.Errorf("knnModel.classify() = %v, %v, want %v, %v", label,
+					confidence, tt.wantLabel, tt.wantConfidence)
+			}
+		})
+	}
+}
+
+func TestKNNOptions_validate(t *testing.T) {
+
+	examples := []KNNExample{{Label: "a", Files: []string{"a.png"}}}
+
+	tests := []struct {
+		name     string
+		opts     *KNNOptions
+		hasModel bool
+		wantErr  bool
+	}{
+		{"Files", &KNNOptions{Examples: examples}, false, false},
+		{"In memory", &KNNOptions{}, true, false},
+		{"No examples", &KNNOptions{}, false, true},
+		{"No options", nil, false, true},
+		{"No label", &KNNOptions{Examples: []KNNExample{{Files: []string{
+			"a.png"}}}}, false, true},
+		{"Features", &KNNOptions{Examples: examples, Features: "sift"}, false,
+			true},
+		{"Size", &KNNOptions{Examples: examples, Size: 2}, false, true},
+		{"Confidence", &KNNOptions{Examples: examples, MinConfidence: 2},
+			false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.validate(tt.hasModel); (err != nil) != tt.wantErr {
+				t.Errorf("KNNOptions.validate() error = %v, wantErr %v", err,
+					tt.wantErr)
+			}
+		})
+	}
+}
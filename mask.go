@@ -0,0 +1,82 @@
+package pokervision
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// loadMask returns the mask of an image reference as an alpha image with the
+// size of the reference image and origin (0,0). Pixels with a non-zero alpha
+// value are compared. nil is returned if the reference is not masked. A
+// preloaded mask image takes precedence over the Mask file.
+func (r *reference) loadMask(spec RefSpec, refImg image.Image) (*image.Alpha,
+	error) {
+
+	if spec.Mask == "" && r.mask == nil && !spec.AlphaMask {
+		return nil, nil
+	}
+
+	// Load mask image.
+	maskImg := r.mask
+	if spec.Mask != "" || maskImg != nil {
+		if maskImg == nil {
+			var err error
+			if maskImg, err = loadImage(spec.Mask); err != nil {
+				return nil, err
+			}
+		}
+
+		if maskImg.Bounds().Size() != refImg.Bounds().Size() {
+			return nil, fmt.Errorf(
+				"Mask is not of the same size as reference image mask='%v' image='%v'",
+				maskImg.Bounds().Size(), refImg.Bounds().Size())
+		}
+	}
+
+	b := refImg.Bounds()
+	mask := image.NewAlpha(image.Rect(0, 0, b.Dx(), b.Dy()))
+
+	for x := 0; x < b.Dx(); x++ {
+		for y := 0; y < b.Dy(); y++ {
+
+			// Skip transparent pixels.
+			if spec.AlphaMask {
+				if _, _, _, a := refImg.At(b.Min.X+x, b.Min.Y+y).RGBA(); a < 0x8000 {
+					continue
+				}
+			}
+
+			// Skip pixels which are not white in the mask image.
+			if maskImg != nil {
+				mb := maskImg.Bounds()
+				red, green, blue, a := maskImg.At(mb.Min.X+x, mb.Min.Y+y).RGBA()
+				lum := (19595*red + 38470*green + 7471*blue + 1<<15) >> 16
+				if lum < 0x8000 || a < 0x8000 {
+					continue
+				}
+			}
+
+			mask.SetAlpha(x, y, color.Alpha{255})
+		}
+	}
+
+	return mask, nil
+}
+
+// compareImagesMasked compares a reference image against a source image pixel
+// by pixel as described by the definition of an image reference, skipping the
+// pixels which are not part of the mask. A nil mask compares all pixels.
+// Images must be of same size. For monochrome references pixels are clamped
+// to foreground and background, otherwise no color component may differ by
+// more than the tolerance in order for function to return true.
+func compareImagesMasked(refImg image.Image, srcImg image.Image,
+	mask *image.Alpha, spec RefSpec) (equal bool) {
+
+	_, stats, err := diffSpec(refImg, srcImg, mask, spec)
+	if err != nil {
+		return false
+	}
+
+	return stats.Equal()
+}
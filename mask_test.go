@@ -0,0 +1,125 @@
+package pokervision
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestNewMatcher_masked(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("NewMatcher() failed to load master image. %v", err)
+	}
+
+	m, err := NewMatcher("./testdata/masked.json")
+	if err != nil {
+		t.Fatalf("NewMatcher() failed to load ref file. %v", err)
+	}
+
+	tests := []struct {
+		srcName string
+		wantRef string
+	}{
+		{"srcImg1", "refGreenMasked"},
+		{"srcMImg1", "refGreenMMasked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.srcName, func(t *testing.T) {
+			if got := m.Match(tt.srcName, img); got != tt.wantRef {
+				t.Errorf("matcher.Match() = %v, want %v", got, tt.wantRef)
+			}
+		})
+	}
+}
+
+func Test_compareImagesMasked(t *testing.T) {
+
+	blackVal, err := loadImage("./testdata/blackVal.png")
+	if err != nil {
+		t.Errorf("compareImagesMasked() failed to load test files. %v", err)
+	}
+
+	// Reference with a transparent, green top and a slightly brighter bottom.
+	b := blackVal.Bounds()
+	ref := image.NewNRGBA(b)
+	draw.Draw(ref, b, blackVal, b.Min, draw.Src)
+	for x := 0; x < b.Dx(); x++ {
+		for y := 0; y < 3; y++ {
+			ref.Set(x, y, color.NRGBA{0, 255, 0, 0})
+		}
+		if c := ref.NRGBAAt(x, 11); c.R < 0xfe {
+			ref.Set(x, 11, color.NRGBA{c.R + 1, c.G + 1, c.B + 1, 255})
+		}
+	}
+
+	r := &reference{RefSpec: RefSpec{Kind: RefImage, AlphaMask: true}}
+	mask, err := r.loadMask(r.RefSpec, ref)
+	if err != nil {
+		t.Fatalf("reference.loadMask() error = %v", err)
+	}
+
+	type args struct {
+		mask *image.Alpha
+		spec RefSpec
+	}
+	tests := []struct {
+		name      string
+		args      args
+		wantEqual bool
+	}{
+		{"Exact", args{mask, RefSpec{Kind: RefImage}}, false},
+		{"Fuzzy", args{mask, RefSpec{Kind: RefImage, Tolerance: 1}}, true},
+		{"Monochrome", args{mask, RefSpec{Kind: RefImageM}}, true},
+		{"Unmasked monochrome", args{nil, RefSpec{Kind: RefImageM}}, false},
+		{"Wrong mask size", args{image.NewAlpha(image.Rect(0, 0, 1, 1)),
+			RefSpec{Kind: RefImage, Tolerance: 255}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareImagesMasked(ref, blackVal, tt.args.mask,
+				tt.args.spec); got != tt.wantEqual {
+				t.Errorf("compareImagesMasked() = %v, want %v", got, tt.wantEqual)
+			}
+		})
+	}
+}
+
+func TestMatcherBuilder_AddMaskedImage(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("MatcherBuilder.AddMaskedImage() failed to load master image. %v", err)
+	}
+	green, err := loadImage("./testdata/blackValGreen.png")
+	if err != nil {
+		t.Errorf("MatcherBuilder.AddMaskedImage() failed to load test files. %v", err)
+	}
+	mask, err := loadImage("./testdata/blackValMask.png")
+	if err != nil {
+		t.Errorf("MatcherBuilder.AddMaskedImage() failed to load test files. %v", err)
+	}
+
+	m, err := NewMatcherBuilder().
+		AddRegion("src", image.Rect(22, 35, 30, 47), "green", "masked").
+		AddImage("green", green, RefSpec{}).
+		AddMaskedImage("masked", green, mask, RefSpec{}).
+		Build()
+	if err != nil {
+		t.Fatalf("MatcherBuilder.Build() error = %v", err)
+	}
+
+	if got := m.Match("src", img); got != "masked" {
+		t.Errorf("matcher.Match() = %v, want masked", got)
+	}
+
+	_, stats, err := DiffSource(m, "src", "masked", img)
+	if err != nil {
+		t.Fatalf("DiffSource() error = %v", err)
+	}
+	if want := 8 * 9; stats.Total != want || !stats.Equal() {
+		t.Errorf("DiffSource() stats = %+v, want %v equal pixels", stats, want)
+	}
+}
@@ -0,0 +1,98 @@
+package pokervision
+
+import (
+	"fmt"
+	"image/color"
+)
+
+// MonochromeOptions configures how monochrome image references clamp pixels
+// to foreground and background. By default only pure white pixels are
+// foreground.
+type MonochromeOptions struct {
+
+	// Threshold makes pixels with a luminance of at least Threshold (1-255)
+	// foreground. 0 disables the threshold.
+	Threshold int `json:",omitempty" yaml:"Threshold,omitempty" toml:",omitempty"`
+
+	// Foreground makes pixels of this HTML color (#rrggbb) foreground. It
+	// takes precedence over Threshold.
+	Foreground string `json:",omitempty" yaml:"Foreground,omitempty" toml:",omitempty"`
+
+	// Tolerance is the largest difference (0-255) of a color component from
+	// Foreground which is still considered foreground.
+	Tolerance int `json:",omitempty" yaml:"Tolerance,omitempty" toml:",omitempty"`
+
+	// Invert swaps foreground and background of the source region, which
+	// allows a reference with light glyphs on a dark background to match dark
+	// glyphs on a light background and vice versa.
+	Invert bool `json:",omitempty" yaml:"Invert,omitempty" toml:",omitempty"`
+}
+
+// validate checks that the options are well-formed.
+func (o *MonochromeOptions) validate() error {
+
+	if o.Threshold < 0 || o.Threshold > 255 {
+		return fmt.Errorf("Illegal monochrome threshold %v", o.Threshold)
+	}
+
+	if o.Foreground != "" {
+		if _, err := parseHTMLColor(o.Foreground); err != nil {
+			return err
+		}
+	}
+
+	if o.Tolerance < 0 || o.Tolerance > 255 {
+		return fmt.Errorf("Illegal monochrome tolerance %v", o.Tolerance)
+	}
+
+	return nil
+}
+
+// classifiers returns the functions telling whether a pixel is foreground in
+// the reference image and in the source region. The options must be valid. A
+// nil receiver returns the default classification.
+func (o *MonochromeOptions) classifiers() (ref func(c color.Color) bool,
+	src func(c color.Color) bool) {
+
+	if o == nil {
+		return isWhite, isWhite
+	}
+
+	switch {
+	case o.Foreground != "":
+		fg, _ := parseHTMLColor(o.Foreground)
+		tol := uint32(o.Tolerance)
+		ref = func(c color.Color) bool {
+			r, g, b, _ := c.RGBA()
+			return absDiff(r>>8, uint32(fg.R)) <= tol &&
+				absDiff(g>>8, uint32(fg.G)) <= tol &&
+				absDiff(b>>8, uint32(fg.B)) <= tol
+		}
+
+	case o.Threshold > 0:
+		threshold := uint32(o.Threshold)
+		ref = func(c color.Color) bool {
+			r, g, b, _ := c.RGBA()
+			lum := (19595*r + 38470*g + 7471*b + 1<<15) >> 16
+			return lum>>8 >= threshold
+		}
+
+	default:
+		ref = isWhite
+	}
+
+	src = ref
+	if o.Invert {
+		src = func(c color.Color) bool {
+			return !ref(c)
+		}
+	}
+
+	return ref, src
+}
+
+// isWhite reports whether a color is pure white.
+func isWhite(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r == 65535 && g == 65535 && b == 65535
+}
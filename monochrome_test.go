@@ -0,0 +1,115 @@
+package pokervision
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestMonochromeOptions_classifiers(t *testing.T) {
+
+	white := color.RGBA{255, 255, 255, 255}
+	offWhite := color.RGBA{240, 240, 230, 255}
+	gray := color.RGBA{128, 128, 128, 255}
+	black := color.RGBA{0, 0, 0, 255}
+
+	tests := []struct {
+		name    string
+		o       *MonochromeOptions
+		c       color.Color
+		wantRef bool
+		wantSrc bool
+	}{
+		{"Default white", nil, white, true, true},
+		{"Default off-white", nil, offWhite, false, false},
+		{"Threshold off-white", &MonochromeOptions{Threshold: 200}, offWhite, true, true},
+		{"Threshold gray", &MonochromeOptions{Threshold: 200}, gray, false, false},
+		{"Foreground", &MonochromeOptions{Foreground: "#f0f0f0", Tolerance: 15},
+			white, true, true},
+		{"Foreground outside tolerance", &MonochromeOptions{Foreground: "#f0f0f0",
+			Tolerance: 9}, offWhite, false, false},
+		{"Foreground overrides threshold", &MonochromeOptions{Threshold: 1,
+			Foreground: "#000000"}, gray, false, false},
+		{"Inverted", &MonochromeOptions{Threshold: 100, Invert: true}, black,
+			false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, src := tt.o.classifiers()
+			if got := ref(tt.c); got != tt.wantRef {
+				t.Errorf("MonochromeOptions.classifiers() ref = %v, want %v", got, tt.wantRef)
+			}
+			if got := src(tt.c); got != tt.wantSrc {
+				t.Errorf("MonochromeOptions.classifiers() src = %v, want %v", got, tt.wantSrc)
+			}
+		})
+	}
+}
+
+func Test_matcher_Match_monochromeOptions(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("matcher.Match() failed to load master image. %v", err)
+	}
+	blackVal, err := loadImage("./testdata/blackVal.png")
+	if err != nil {
+		t.Errorf("matcher.Match() failed to load test files. %v", err)
+	}
+
+	// Off-white and inverted variants of the reference.
+	b := blackVal.Bounds()
+	offWhite := image.NewRGBA(b)
+	inverted := image.NewRGBA(b)
+	for x := b.Min.X; x < b.Max.X; x++ {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			c := color.RGBAModel.Convert(blackVal.At(x, y)).(color.RGBA)
+			inverted.Set(x, y, color.RGBA{255 - c.R, 255 - c.G, 255 - c.B, 255})
+			if c.R == 255 {
+				c = color.RGBA{240, 240, 240, 255}
+			}
+			offWhite.Set(x, y, c)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		ref   image.Image
+		opts  *MonochromeOptions
+		match bool
+	}{
+		{"Off-white default", offWhite, nil, false},
+		{"Off-white threshold", offWhite, &MonochromeOptions{Threshold: 200}, true},
+		{"Off-white foreground", offWhite, &MonochromeOptions{
+			Foreground: "#f0f0f0", Tolerance: 15}, true},
+		{"Inverted", inverted, &MonochromeOptions{Threshold: 128}, false},
+		{"Inverted mode", inverted, &MonochromeOptions{Threshold: 128,
+			Invert: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMatcherBuilder().
+				AddRegion("src", image.Rect(22, 35, 30, 47), "ref").
+				AddImage("ref", tt.ref, RefSpec{Kind: RefImageM,
+					Monochrome: tt.opts}).
+				Build()
+			if err != nil {
+				t.Fatalf("MatcherBuilder.Build() error = %v", err)
+			}
+			if got := m.Match("src", img) == "ref"; got != tt.match {
+				t.Errorf("matcher.Match() matched = %v, want %v", got, tt.match)
+			}
+		})
+	}
+
+	// Options are only allowed on monochrome references.
+	if _, err := NewMatcherBuilder().AddImage("ref", blackVal, RefSpec{
+		Monochrome: &MonochromeOptions{}}).Build(); err == nil {
+		t.Errorf("MatcherBuilder.Build() error = nil, want error")
+	}
+	if _, err := NewMatcherBuilder().AddImage("ref", blackVal, RefSpec{
+		Kind: RefImageM, Monochrome: &MonochromeOptions{Foreground: "white"},
+	}).Build(); err == nil {
+		t.Errorf("MatcherBuilder.Build() error = nil, want error")
+	}
+}
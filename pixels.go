@@ -0,0 +1,168 @@
+package pokervision
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+)
+
+// isPixelSet reports whether the source samples a set of pixels rather than a
+// single pixel or a region.
+func (s *source) isPixelSet() bool {
+	return len(s.Src) == 0 && (len(s.Points) > 0 || len(s.Grid) > 0)
+}
+
+// validate checks that the source describes a pixel, a region or a pixel set.
+func (s *source) validate() error {
+
+	if s.MinMargin < 0 || s.MinMargin > 1 {
+		return fmt.Errorf("Illegal minimum margin %v srcName=%v", s.MinMargin,
+			s.Name)
+	}
+
+	if s.isPixelSet() {
+		for _, p := range s.Points {
+			if len(p) != 2 {
+				return fmt.Errorf(
+					"Illegal point - len(Point) must be 2 srcName=%v point=%v",
+					s.Name, p)
+			}
+		}
+
+		if len(s.Grid) > 0 &&
+			(len(s.Grid) != 6 || s.Grid[2] <= 0 || s.Grid[3] <= 0 ||
+				s.Grid[4] <= 0 || s.Grid[5] <= 0) {
+			return fmt.Errorf(
+				"Illegal grid - Grid must be 6 positive ints srcName=%v grid=%v",
+				s.Name, s.Grid)
+		}
+
+		return nil
+	}
+
+	if len(s.Src) != 2 && len(s.Src) != 4 {
+		return fmt.Errorf(
+			"Illegal source - len(Src) must be 2 or 4 srcName=%v", s.Name)
+	}
+
+	return nil
+}
+
+// points returns the pixels sampled by a pixel set source: the listed points
+// followed by the centers of the grid cells, row by row.
+func (s *source) points() []image.Point {
+
+	var pts []image.Point
+	for _, p := range s.Points {
+		pts = append(pts, image.Pt(p[0], p[1]))
+	}
+
+	if len(s.Grid) == 6 {
+		x, y, w, h, cols, rows := s.Grid[0], s.Grid[1], s.Grid[2], s.Grid[3],
+			s.Grid[4], s.Grid[5]
+		for j := 0; j < rows; j++ {
+			for i := 0; i < cols; i++ {
+				pts = append(pts, image.Pt(x+(2*i+1)*w/(2*cols),
+					y+(2*j+1)*h/(2*rows)))
+			}
+		}
+	}
+
+	return pts
+}
+
+// samplePixels samples the pixels of a pixel set source. The colors are
+// returned as an image one pixel high, in the order of points().
+func samplePixels(s *source, img image.Image) image.Image {
+
+	pts := s.points()
+	out := image.NewRGBA(image.Rect(0, 0, len(pts), 1))
+	for i, p := range pts {
+		out.Set(i, 0, img.At(p.X, p.Y))
+	}
+
+	return out
+}
+
+// handlePixels handles a comparison with a pixel signature reference.
+func handlePixels(r *reference, srcColors []color.Color) string {
+
+	spec, err := r.spec()
+	if err != nil {
+		log.Printf("error: %v refName=%v", err, r.Name)
+		return ""
+	}
+
+	agree, err := comparePixels(spec, srcColors)
+	if err != nil {
+		log.Printf("error: %v refName=%v", err, r.Name)
+		return ""
+	}
+
+	if pixelsMatch(spec, agree, len(srcColors)) {
+		return r.result()
+	}
+
+	return ""
+}
+
+// comparePixels counts the sampled colors which are within the tolerance of
+// the expected colors of a pixel signature reference.
+func comparePixels(spec RefSpec, srcColors []color.Color) (agree int,
+	err error) {
+
+	want := spec.Colors
+	if len(want) == 0 {
+		want = []string{spec.Color}
+	}
+	if len(want) != 1 && len(want) != len(srcColors) {
+		return 0, fmt.Errorf(
+			"Number of colors does not match number of pixels colors=%v pixels=%v",
+			len(want), len(srcColors))
+	}
+
+	tol := uint32(spec.Tolerance)
+	for i, srcColor := range srcColors {
+		c, err := parseHTMLColor(want[i%len(want)])
+		if err != nil {
+			return 0, err
+		}
+
+		red, green, blue, _ := srcColor.RGBA()
+		if absDiff(red/256, uint32(c.R)) <= tol &&
+			absDiff(green/256, uint32(c.G)) <= tol &&
+			absDiff(blue/256, uint32(c.B)) <= tol {
+			agree++
+		}
+	}
+
+	return agree, nil
+}
+
+// pixelsMatch reports whether enough of the sampled pixels agree with a pixel
+// signature reference.
+func pixelsMatch(spec RefSpec, agree, total int) bool {
+
+	fraction := spec.Fraction
+	if fraction == 0 {
+		fraction = 1
+	}
+
+	// Allow for rounding errors.
+	return total > 0 && float64(agree) >= fraction*float64(total)-1e-9
+}
+
+// imageColors returns the colors of an image row by row.
+func imageColors(img image.Image) []color.Color {
+
+	b := img.Bounds()
+	colors := make([]color.Color, 0, b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			colors = append(colors, img.At(x, y))
+		}
+	}
+
+	return colors
+}
@@ -0,0 +1,169 @@
+package pokervision
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestNewMatcher_pixels(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("NewMatcher() failed to load master image. %v", err)
+	}
+
+	m, err := NewMatcher("./testdata/pixels.json")
+	if err != nil {
+		t.Fatalf("NewMatcher() failed to load ref file. %v", err)
+	}
+
+	tests := []struct {
+		srcName string
+		wantRef string
+	}{
+		{"srcButton", "refMostlyPurple"},
+		{"srcGrid", "refSig"},
+		{"srcPixel", "refMostlyPurple"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.srcName, func(t *testing.T) {
+			if got := m.Match(tt.srcName, img); got != tt.wantRef {
+				t.Errorf("matcher.Match() = %v, want %v", got, tt.wantRef)
+			}
+		})
+	}
+}
+
+func Test_source_points(t *testing.T) {
+
+	tests := []struct {
+		name string
+		src  source
+		want []image.Point
+	}{
+		{"Points", source{Points: [][]int{{1, 2}, {3, 4}}},
+			[]image.Point{{1, 2}, {3, 4}}},
+		{"Grid", source{Grid: []int{10, 20, 4, 6, 2, 3}},
+			[]image.Point{{11, 21}, {13, 21}, {11, 23}, {13, 23}, {11, 25},
+				{13, 25}}},
+		{"Points and grid", source{Points: [][]int{{0, 0}},
+			Grid: []int{0, 0, 2, 2, 1, 1}}, []image.Point{{0, 0}, {1, 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.src.points(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("source.points() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_source_validate(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		src     source
+		wantErr bool
+	}{
+		{"Pixel", source{Src: []int{1, 2}}, false},
+		{"Region", source{Src: []int{1, 2, 3, 4}}, false},
+		{"Points", source{Points: [][]int{{1, 2}}}, false},
+		{"Grid", source{Grid: []int{1, 2, 3, 4, 2, 2}}, false},
+		{"Empty", source{}, true},
+		{"Illegal point", source{Points: [][]int{{1, 2, 3}}}, true},
+		{"Short grid", source{Grid: []int{1, 2, 3, 4}}, true},
+		{"Empty grid", source{Grid: []int{1, 2, 3, 4, 0, 2}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.src.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("source.validate() error = %v, wantErr %v", err,
+					tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_comparePixels(t *testing.T) {
+
+	red := color.RGBA{255, 0, 0, 255}
+	green := color.RGBA{0, 255, 0, 255}
+	srcColors := []color.Color{red, red, green, color.RGBA{250, 5, 5, 255}}
+
+	tests := []struct {
+		name      string
+		spec      RefSpec
+		wantAgree int
+		wantMatch bool
+		wantErr   bool
+	}{
+		{"Single color", RefSpec{Color: "#ff0000"}, 2, false, false},
+		{"Tolerance", RefSpec{Color: "#ff0000", Tolerance: 5}, 3, false, false},
+		{"Fraction", RefSpec{Color: "#ff0000", Tolerance: 5, Fraction: 0.75},
+			3, true, false},
+		{"Signature", RefSpec{Colors: []string{"#ff0000", "#ff0000",
+			"#00ff00", "#fa0505"}}, 4, true, false},
+		{"Signature length", RefSpec{Colors: []string{"#ff0000",
+			"#ff0000"}}, 0, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agree, err := comparePixels(tt.spec, srcColors)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("comparePixels() error = %v, wantErr %v", err,
+					tt.wantErr)
+			}
+			if agree != tt.wantAgree {
+				t.Errorf("comparePixels() = %v, want %v", agree, tt.wantAgree)
+			}
+			if got := pixelsMatch(tt.spec, agree, len(srcColors)); got != tt.wantMatch {
+				t.Errorf("pixelsMatch() = %v, want %v", got, tt.wantMatch)
+			}
+		})
+	}
+}
+
+func TestMatcherBuilder_AddPoints(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("MatcherBuilder.AddPoints() failed to load master image. %v", err)
+	}
+
+	purple := color.RGBA{0xd7, 0x42, 0xf4, 255}
+	m, err := NewMatcherBuilder().
+		AddPoints("button", []image.Point{{8, 28}, {9, 28}, {0, 0}}, "on").
+		AddGrid("grid", image.Rect(22, 35, 30, 47), 2, 3, "white").
+		AddPixels("on", []color.Color{purple}, 0, 0.6).
+		AddPixels("white", []color.Color{color.White}, 0, 0.5).
+		Build()
+	if err != nil {
+		t.Fatalf("MatcherBuilder.Build() error = %v", err)
+	}
+
+	for src, want := range map[string]string{"button": "on", "grid": "white"} {
+		if got := m.Match(src, img); got != want {
+			t.Errorf("matcher.Match(%v) = %v, want %v", src, got, want)
+		}
+	}
+}
+
+func Test_source_offset_pixelSet(t *testing.T) {
+
+	s := source{Name: "s", Points: [][]int{{1, 2}}, Grid: []int{0, 0, 4, 4, 2, 2}}
+	got := s.offset("t", 10, 20)
+
+	want := source{Name: "t", Points: [][]int{{11, 22}},
+		Grid: []int{10, 20, 4, 4, 2, 2}}
+	if !reflect.DeepEqual(got.Points, want.Points) ||
+		!reflect.DeepEqual(got.Grid, want.Grid) || got.Name != want.Name {
+		t.Errorf("source.offset() = %+v, want %+v", got, want)
+	}
+
+	// The original source is left untouched.
+	if s.Points[0][0] != 1 || s.Grid[0] != 0 {
+		t.Errorf("source = %+v, want unchanged", s)
+	}
+}
@@ -0,0 +1,173 @@
+package pokervision
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"sync"
+)
+
+// ProfileRegistry holds matchers for different poker rooms and table themes
+// and detects which of them applies to a screenshot.
+type ProfileRegistry interface {
+
+	// Add registers a profile. A profile is detected when each source in
+	// fingerprint matches the reference of the given name, regardless of its
+	// value. An empty reference name accepts any match.
+	Add(name string, m Matcher, fingerprint map[string]string)
+
+	// Profile returns the matcher of a registered profile, or nil.
+	Profile(name string) Matcher
+
+	// Detect returns the first registered profile whose fingerprint matches
+	// img. If no profile matches, name is empty and m is nil.
+	Detect(img image.Image) (name string, m Matcher)
+}
+
+// NewProfileRegistry creates an empty profile registry.
+func NewProfileRegistry() ProfileRegistry {
+	return new(profileRegistry)
+}
+
+// LoadProfileRegistry creates a profile registry from a JSON encoded file
+// listing the ref file and fingerprint of each profile.
+func LoadProfileRegistry(profileFile string) (ProfileRegistry, error) {
+
+	// Read JSON file containing profiles.
+	reader := fileLoader.Load(profileFile)
+	if reader == nil {
+		return nil, errors.New("Failed to load profile file")
+	}
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(reader)
+
+	var pf struct {
+		Profiles []struct {
+			Name    string
+			RefFile string
+			Detect  map[string]string
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &pf); err != nil {
+		return nil, err
+	}
+
+	reg := new(profileRegistry)
+	for _, p := range pf.Profiles {
+		if len(p.Detect) == 0 {
+			return nil, fmt.Errorf("Profile has no detection rules profile=%v",
+				p.Name)
+		}
+
+		m, err := NewMatcher(p.RefFile)
+		if err != nil {
+			return nil, fmt.Errorf("%v profile=%v", err, p.Name)
+		}
+
+		reg.Add(p.Name, m, p.Detect)
+	}
+
+	return reg, nil
+}
+
+// profile is a matcher together with the sources identifying it.
+type profile struct {
+	name        string
+	m           Matcher
+	fingerprint map[string]string
+}
+
+// profileRegistry implements ProfileRegistry.
+type profileRegistry struct {
+	mu       sync.RWMutex
+	profiles []profile
+}
+
+// Add registers a profile, replacing any profile of the same name.
+func (reg *profileRegistry) Add(name string, m Matcher,
+	fingerprint map[string]string) {
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	p := profile{name, m, fingerprint}
+	for i := range reg.profiles {
+		if reg.profiles[i].name == name {
+			reg.profiles[i] = p
+			return
+		}
+	}
+
+	reg.profiles = append(reg.profiles, p)
+}
+
+// Profile returns the matcher of a registered profile.
+func (reg *profileRegistry) Profile(name string) Matcher {
+
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	for _, p := range reg.profiles {
+		if p.name == name {
+			return p.m
+		}
+	}
+
+	return nil
+}
+
+// Detect returns the first profile whose fingerprint matches img.
+func (reg *profileRegistry) Detect(img image.Image) (string, Matcher) {
+
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	for _, p := range reg.profiles {
+		if p.detect(img) {
+			return p.name, p.m
+		}
+	}
+
+	return "", nil
+}
+
+// detect determines if all fingerprint sources match.
+func (p *profile) detect(img image.Image) bool {
+
+	if len(p.fingerprint) == 0 {
+		return false
+	}
+
+	for srcName, refName := range p.fingerprint {
+		match := matchedRef(p.m, srcName, img)
+		if match == "" || (refName != "" && match != refName) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchedRef returns the name of the reference Match chooses for a source,
+// which differs from its result if the reference has a value. Like in Match,
+// references are compared in order up to the first one which matches. For
+// matchers other than the ones of this package, the result of Match is
+// returned.
+func matchedRef(m Matcher, srcName string, img image.Image) string {
+
+	im, ok := asMatcher(m)
+	if !ok || im == nil {
+		return m.Match(srcName, img)
+	}
+
+	s := im.findSource(srcName)
+	if s == nil {
+		return ""
+	}
+
+	rs, _ := im.matchScore(s, img)
+
+	return rs.Name
+}
@@ -0,0 +1,128 @@
+package pokervision
+
+import (
+	"image"
+	"testing"
+)
+
+func TestLoadProfileRegistry(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("LoadProfileRegistry() failed to load master image. %v", err)
+	}
+
+	type args struct {
+		profileFile string
+	}
+	tests := []struct {
+		name        string
+		args        args
+		wantProfile string
+		wantErr     bool
+	}{
+		{"Valid", args{"./testdata/profiles.json"}, "dark", false},
+		{"Does not exist", args{"./testdata/noExist.json"}, "", true},
+		{"Malformed", args{"./testdata/malformed.json"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg, err := LoadProfileRegistry(tt.args.profileFile)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadProfileRegistry() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if name, m := reg.Detect(img); name != tt.wantProfile || m == nil {
+				t.Errorf("Detect() = %v, %v, want %v", name, m, tt.wantProfile)
+			}
+		})
+	}
+}
+
+func Test_profileRegistry_Detect(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("profileRegistry.Detect() failed to load master image. %v", err)
+	}
+
+	m, err := NewMatcher("./testdata/refs.json")
+	if err != nil {
+		t.Errorf("profileRegistry.Detect() failed to load ref file. %v", err)
+	}
+
+	// Fingerprints name references, not their values.
+	valued := &matcher{
+		Srcs: []source{{Name: "src", Src: []int{9, 28}, Refs: []string{"ref"}}},
+		Refs: []reference{{Name: "ref", Value: "purple", Ref: "color:#d742f4"}},
+	}
+
+	// References after the matching one are not compared.
+	trailing := &matcher{
+		Srcs: []source{{Name: "src", Src: []int{9, 28},
+			Refs: []string{"ref", "image"}}},
+		Refs: []reference{{Name: "ref", Ref: "color:#d742f4"},
+			{Name: "image", Ref: "image:./testdata/blackVal.png"}},
+	}
+
+	tests := []struct {
+		name        string
+		m           Matcher
+		fingerprint map[string]string
+		want        string
+	}{
+		{"Specific reference", m, map[string]string{"srcColor1": "refColor2"}, "p"},
+		{"Any reference", m, map[string]string{"srcImg1": ""}, "p"},
+		{"Wrong reference", m, map[string]string{"srcColor1": "refColor1"}, ""},
+		{"No match", m, map[string]string{"srcImg1": "", "srcColor2": ""}, ""},
+		{"No source", m, map[string]string{"noSuchSource": ""}, ""},
+		{"No rules", m, nil, ""},
+		{"Reference name", valued, map[string]string{"src": "ref"}, "p"},
+		{"Reference value", valued, map[string]string{"src": "purple"}, ""},
+		{"Incompatible later reference", trailing, map[string]string{"src": "ref"},
+			"p"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := NewProfileRegistry()
+			reg.Add("p", tt.m, tt.fingerprint)
+			if got, _ := reg.Detect(img); got != tt.want {
+				t.Errorf("profileRegistry.Detect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_profileRegistry_Profile(t *testing.T) {
+
+	m1, m2 := &matcher{}, &matcher{}
+
+	reg := NewProfileRegistry()
+	reg.Add("a", m1, nil)
+	reg.Add("b", m1, nil)
+	reg.Add("b", m2, nil)
+
+	tests := []struct {
+		name string
+		want Matcher
+	}{
+		{"a", m1},
+		{"b", m2},
+		{"c", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reg.Profile(tt.name); got != tt.want {
+				t.Errorf("profileRegistry.Profile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var img image.Image = image.NewRGBA(image.Rect(0, 0, 1, 1))
+	if name, _ := reg.Detect(img); name != "" {
+		t.Errorf("profileRegistry.Detect() = %v, want no profile", name)
+	}
+}
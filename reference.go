@@ -0,0 +1,439 @@
+package pokervision
+
+import (
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RefKind is the kind of comparison a reference performs.
+type RefKind string
+
+const (
+	// RefColor compares a pixel against a color.
+	RefColor RefKind = "color"
+
+	// RefImage compares a region against an image.
+	RefImage RefKind = "image"
+
+	// RefImageM compares a region against an image after clamping both to
+	// white and non-white.
+	RefImageM RefKind = "imageM"
+
+	// RefOCR reads the text of a region.
+	RefOCR RefKind = "ocr"
+
+	// RefHistogram compares the color histogram of a region against the
+	// histogram of an image.
+	RefHistogram RefKind = "histogram"
+
+	// RefDominant compares the dominant color of a region against a color.
+	RefDominant RefKind = "dominant"
+
+	// RefPixels compares the pixels of a source against a list of colors and
+	// matches if enough of them agree.
+	RefPixels RefKind = "pixels"
+
+	// RefEdges compares the edges of a region against the edges of an image,
+	// which ignores changes of background color and brightness.
+	RefEdges RefKind = "edges"
+
+	// RefKNN classifies a region by the labels of the most similar example
+	// images. Match returns the label.
+	RefKNN RefKind = "knn"
+)
+
+// OCROptions configures an OCR reference.
+type OCROptions struct {
+
+	// Width is the width the region is resized to before OCR. The aspect
+	// ratio is kept. 0 keeps the original size.
+	Width int `json:",omitempty" yaml:"Width,omitempty" toml:",omitempty"`
+
+	// Pattern is a regular expression the recognized text must match for the
+	// reference to match. Empty accepts any text.
+	Pattern string `json:",omitempty" yaml:"Pattern,omitempty" toml:",omitempty"`
+}
+
+// Preprocess describes how a region is prepared before it is compared. For
+// image references the reference image is prepared the same way.
+type Preprocess struct {
+
+	// Grayscale converts the region to grayscale.
+	Grayscale bool `json:",omitempty" yaml:"Grayscale,omitempty" toml:",omitempty"`
+
+	// Invert inverts the colors of the region.
+	Invert bool `json:",omitempty" yaml:"Invert,omitempty" toml:",omitempty"`
+
+	// Threshold turns pixels with a luminance of at least Threshold (1-255)
+	// white and all other pixels black. 0 disables thresholding.
+	Threshold int `json:",omitempty" yaml:"Threshold,omitempty" toml:",omitempty"`
+}
+
+// RefSpec is the structured definition of a reference.
+type RefSpec struct {
+
+	// Kind is the kind of comparison.
+	Kind RefKind `json:",omitempty" yaml:"Kind,omitempty" toml:",omitempty"`
+
+	// File is the reference image of image, edge and histogram references.
+	File string `json:",omitempty" yaml:"File,omitempty" toml:",omitempty"`
+
+	// Mask is an image marking the pixels of the reference image which are
+	// compared. White pixels are compared, black pixels are ignored.
+	Mask string `json:",omitempty" yaml:"Mask,omitempty" toml:",omitempty"`
+
+	// AlphaMask ignores the pixels of the reference image which are more than
+	// half transparent.
+	AlphaMask bool `json:",omitempty" yaml:"AlphaMask,omitempty" toml:",omitempty"`
+
+	// Monochrome configures how monochrome image references tell foreground
+	// from background.
+	Monochrome *MonochromeOptions `json:",omitempty" yaml:"Monochrome,omitempty" toml:",omitempty"`
+
+	// Color is the HTML color (#rrggbb) of color and dominant color
+	// references. Pixel signature references without Colors expect all pixels
+	// to have this color.
+	Color string `json:",omitempty" yaml:"Color,omitempty" toml:",omitempty"`
+
+	// Colors are the HTML colors expected by a pixel signature reference, one
+	// for each pixel of the source.
+	Colors []string `json:",omitempty" yaml:"Colors,omitempty" toml:",omitempty"`
+
+	// Fraction is the smallest fraction (0-1) of pixels which must agree with
+	// a pixel signature reference for it to match. 0 requires all pixels to
+	// agree.
+	Fraction float64 `json:",omitempty" yaml:"Fraction,omitempty" toml:",omitempty"`
+
+	// Tolerance is the largest difference (0-255) of a color component which
+	// is still considered equal by color, dominant color, pixel signature and
+	// image references.
+	Tolerance int `json:",omitempty" yaml:"Tolerance,omitempty" toml:",omitempty"`
+
+	// OCR configures OCR references.
+	OCR *OCROptions `json:",omitempty" yaml:"OCR,omitempty" toml:",omitempty"`
+
+	// KNN configures kNN references.
+	KNN *KNNOptions `json:",omitempty" yaml:"KNN,omitempty" toml:",omitempty"`
+
+	// Edges configures edge references.
+	Edges *EdgeOptions `json:",omitempty" yaml:"Edges,omitempty" toml:",omitempty"`
+
+	// Histogram configures histogram and dominant color references.
+	Histogram *HistogramOptions `json:",omitempty" yaml:"Histogram,omitempty" toml:",omitempty"`
+
+	// Preprocess describes how regions are prepared before comparison.
+	Preprocess *Preprocess `json:",omitempty" yaml:"Preprocess,omitempty" toml:",omitempty"`
+}
+
+// String formats the definition in the legacy prefix notation, followed by
+// any options which cannot be expressed in it.
+func (s RefSpec) String() string {
+
+	var str string
+	switch s.Kind {
+	case RefColor, RefDominant:
+		str = string(s.Kind) + ":" + s.Color
+	case RefHistogram, RefEdges:
+		str = string(s.Kind) + ":" + s.File
+	case RefImage, RefImageM:
+		str = string(s.Kind) + ":" + s.File
+	case RefPixels:
+		str = string(s.Kind) + ":" + s.Color
+		if len(s.Colors) > 0 {
+			str = string(s.Kind) + ":" + strings.Join(s.Colors, ",")
+		}
+	case RefKNN:
+		str = "knn:"
+		if s.KNN != nil {
+			var labels []string
+			for _, e := range s.KNN.Examples {
+				labels = append(labels, e.Label)
+			}
+			str += strings.Join(labels, ",")
+		}
+	case RefOCR:
+		str = "ocr:"
+		if s.OCR != nil && s.OCR.Width > 0 {
+			str += strconv.Itoa(s.OCR.Width)
+		}
+	default:
+		str = string(s.Kind)
+	}
+
+	if s.Tolerance != 0 {
+		str += fmt.Sprintf(" tolerance=%v", s.Tolerance)
+	}
+	if s.Fraction != 0 {
+		str += fmt.Sprintf(" fraction=%v", s.Fraction)
+	}
+	if s.Mask != "" {
+		str += fmt.Sprintf(" mask=%v", s.Mask)
+	}
+	if s.AlphaMask {
+		str += " alphamask"
+	}
+	if s.Monochrome != nil {
+		str += fmt.Sprintf(" monochrome=%+v", *s.Monochrome)
+	}
+	if s.OCR != nil && s.OCR.Pattern != "" {
+		str += fmt.Sprintf(" pattern=%v", s.OCR.Pattern)
+	}
+	if s.KNN != nil {
+		str += fmt.Sprintf(" k=%v features=%v", s.KNN.k(), s.KNN.features())
+		if s.KNN.MinConfidence != 0 {
+			str += fmt.Sprintf(" confidence=%v", s.KNN.MinConfidence)
+		}
+	}
+	if s.Edges != nil {
+		str += fmt.Sprintf(" edges=%+v", *s.Edges)
+	}
+	if s.Histogram != nil {
+		str += fmt.Sprintf(" histogram=%+v", *s.Histogram)
+	}
+	if s.Preprocess != nil {
+		str += fmt.Sprintf(" preprocess=%+v", *s.Preprocess)
+	}
+
+	return str
+}
+
+// isImage reports whether the definition compares against an image.
+func (s RefSpec) isImage() bool {
+	return s.Kind == RefImage || s.Kind == RefImageM
+}
+
+// hasFile reports whether the definition refers to a reference image.
+func (s RefSpec) hasFile() bool {
+	return s.isImage() || s.Kind == RefHistogram || s.Kind == RefEdges
+}
+
+// validate checks that the definition is complete and well-formed. hasImage
+// tells if the reference image or the kNN examples are held in memory, in
+// which case image and kNN references need no files.
+func (s RefSpec) validate(hasImage bool) error {
+
+	switch s.Kind {
+	case RefColor, RefDominant:
+		if _, err := parseHTMLColor(s.Color); err != nil {
+			return err
+		}
+
+	case RefImage, RefImageM, RefHistogram, RefEdges:
+		if s.File == "" && !hasImage {
+			return fmt.Errorf("Image reference without file")
+		}
+
+	case RefPixels:
+		if len(s.Colors) == 0 {
+			if _, err := parseHTMLColor(s.Color); err != nil {
+				return err
+			}
+		}
+		for _, c := range s.Colors {
+			if _, err := parseHTMLColor(c); err != nil {
+				return err
+			}
+		}
+
+	case RefKNN:
+		if err := s.KNN.validate(hasImage); err != nil {
+			return err
+		}
+
+	case RefOCR:
+		if s.OCR != nil && s.OCR.Pattern != "" {
+			if _, err := regexp.Compile(s.OCR.Pattern); err != nil {
+				return fmt.Errorf("Illegal OCR pattern %v", err)
+			}
+		}
+
+	default:
+		return fmt.Errorf("Invalid reference type kind=%v", s.Kind)
+	}
+
+	if !s.isImage() && (s.Mask != "" || s.AlphaMask) {
+		return fmt.Errorf("Mask on a reference which is not an image kind=%v",
+			s.Kind)
+	}
+
+	if s.Monochrome != nil {
+		if s.Kind != RefImageM {
+			return fmt.Errorf(
+				"Monochrome options on a reference which is not monochrome kind=%v",
+				s.Kind)
+		}
+		if err := s.Monochrome.validate(); err != nil {
+			return err
+		}
+	}
+
+	if s.KNN != nil && s.Kind != RefKNN {
+		return fmt.Errorf("kNN options on a reference which is not kNN kind=%v",
+			s.Kind)
+	}
+
+	if s.Edges != nil {
+		if s.Kind != RefEdges {
+			return fmt.Errorf(
+				"Edge options on a reference which is not an edge kind=%v",
+				s.Kind)
+		}
+		if err := s.Edges.validate(); err != nil {
+			return err
+		}
+	}
+
+	if s.Histogram != nil {
+		if s.Kind != RefHistogram && s.Kind != RefDominant {
+			return fmt.Errorf(
+				"Histogram options on a reference which is not a histogram kind=%v",
+				s.Kind)
+		}
+		if err := s.Histogram.validate(); err != nil {
+			return err
+		}
+	}
+
+	if s.Fraction != 0 && s.Kind != RefPixels {
+		return fmt.Errorf(
+			"Fraction on a reference which is not a pixel signature kind=%v",
+			s.Kind)
+	}
+	if s.Fraction < 0 || s.Fraction > 1 {
+		return fmt.Errorf("Illegal fraction %v", s.Fraction)
+	}
+
+	if s.Tolerance < 0 || s.Tolerance > 255 {
+		return fmt.Errorf("Illegal tolerance %v", s.Tolerance)
+	}
+
+	if p := s.Preprocess; p != nil && (p.Threshold < 0 || p.Threshold > 255) {
+		return fmt.Errorf("Illegal threshold %v", p.Threshold)
+	}
+
+	return nil
+}
+
+// spec returns the structured definition of a reference. If Kind is not set,
+// the legacy prefix string in Ref is parsed instead.
+func (r *reference) spec() (RefSpec, error) {
+
+	spec := r.RefSpec
+	if spec.Kind == "" {
+		var err error
+		if spec, err = parseLegacyRef(r.Ref); err != nil {
+			return spec, err
+		}
+	}
+
+	if err := spec.validate(r.img != nil || r.knn != nil); err != nil {
+		return spec, err
+	}
+
+	return spec, nil
+}
+
+// parseLegacyRef parses a reference in the legacy prefix notation, such as
+// "color:#4268f4", "imageM:./x.png" or "ocr:200".
+func parseLegacyRef(ref string) (RefSpec, error) {
+
+	switch {
+	case strings.HasPrefix(ref, "color:"):
+		return RefSpec{Kind: RefColor, Color: ref[len("color:"):]}, nil
+
+	case strings.HasPrefix(ref, "image:"):
+		return RefSpec{Kind: RefImage, File: ref[len("image:"):]}, nil
+
+	case strings.HasPrefix(ref, "imageM:"):
+		return RefSpec{Kind: RefImageM, File: ref[len("imageM:"):]}, nil
+
+	case strings.HasPrefix(ref, "ocr:"):
+		opts, err := parseOCRArgs(ref[len("ocr:"):])
+		if err != nil {
+			return RefSpec{}, err
+		}
+		return RefSpec{Kind: RefOCR, OCR: opts}, nil
+	}
+
+	return RefSpec{}, fmt.Errorf("Invalid reference type ref=%v", ref)
+}
+
+// parseOCRArgs parses the comma separated arguments of a legacy OCR reference.
+// The first argument is the width the region is resized to. Further arguments
+// are ignored.
+func parseOCRArgs(args string) (*OCROptions, error) {
+
+	opts := new(OCROptions)
+
+	strs := strings.Split(args, ",")
+	if len(strs[0]) != 0 {
+		w, err := strconv.Atoi(strs[0])
+		if err != nil {
+			return nil, fmt.Errorf("Illegal OCR arg width=%v", strs[0])
+		}
+		opts.Width = w
+	}
+
+	return opts, nil
+}
+
+// parseHTMLColor parses an HTML color of the form #rrggbb.
+func parseHTMLColor(s string) (color.RGBA, error) {
+
+	// Assert HTML color format (this check allows the following slicing).
+	if len(s) != 7 || s[0] != '#' {
+		return color.RGBA{}, fmt.Errorf("Invalid color, expected HTML color color=%v", s)
+	}
+
+	b, err := hex.DecodeString(s[1:])
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("Invalid color, expected HTML color color=%v", s)
+	}
+
+	return color.RGBA{b[0], b[1], b[2], 255}, nil
+}
+
+// preprocess prepares an image as described by p. The image is returned
+// unchanged if p is nil.
+func preprocess(img image.Image, p *Preprocess) image.Image {
+
+	if p == nil || (!p.Grayscale && !p.Invert && p.Threshold == 0) {
+		return img
+	}
+
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+
+	for x := 0; x < b.Dx(); x++ {
+		for y := 0; y < b.Dy(); y++ {
+			r, g, bl, a := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+
+			// Colors are alpha-premultiplied, so a is the brightest value.
+			if p.Grayscale || p.Threshold > 0 {
+				lum := (19595*r + 38470*g + 7471*bl + 1<<15) >> 16
+				r, g, bl = lum, lum, lum
+			}
+
+			if p.Threshold > 0 {
+				if r>>8 >= uint32(p.Threshold) {
+					r, g, bl = a, a, a
+				} else {
+					r, g, bl = 0, 0, 0
+				}
+			}
+
+			if p.Invert {
+				r, g, bl = a-r, a-g, a-bl
+			}
+
+			out.Set(x, y, color.RGBA64{uint16(r), uint16(g), uint16(bl), uint16(a)})
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,164 @@
+package pokervision
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestNewMatcher_structured(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("NewMatcher() failed to load master image. %v", err)
+	}
+
+	m, err := NewMatcher("./testdata/structured.json")
+	if err != nil {
+		t.Fatalf("NewMatcher() failed to load ref file. %v", err)
+	}
+
+	tests := []struct {
+		srcName string
+		wantRef string
+	}{
+		{"srcImg1", "refImg2"},
+		{"srcMImg1", "refMImg1"},
+		{"srcColor1", "refColorNear"},
+		{"srcInverted", "refInverted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.srcName, func(t *testing.T) {
+			if got := m.Match(tt.srcName, img); got != tt.wantRef {
+				t.Errorf("matcher.Match() = %v, want %v", got, tt.wantRef)
+			}
+		})
+	}
+}
+
+func Test_reference_spec(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		r       reference
+		want    RefSpec
+		wantErr bool
+	}{
+		{"Legacy color", reference{Ref: "color:#4268f4"},
+			RefSpec{Kind: RefColor, Color: "#4268f4"}, false},
+		{"Legacy image", reference{Ref: "image:./x.png"},
+			RefSpec{Kind: RefImage, File: "./x.png"}, false},
+		{"Legacy monochrome image", reference{Ref: "imageM:./x.png"},
+			RefSpec{Kind: RefImageM, File: "./x.png"}, false},
+		{"Legacy OCR", reference{Ref: "ocr:200,y"},
+			RefSpec{Kind: RefOCR, OCR: &OCROptions{Width: 200}}, false},
+		{"Legacy OCR without args", reference{Ref: "ocr:"},
+			RefSpec{Kind: RefOCR, OCR: &OCROptions{}}, false},
+		{"Legacy invalid OCR", reference{Ref: "ocr:asd"}, RefSpec{}, true},
+		{"Legacy invalid color", reference{Ref: "color:#4268fg"}, RefSpec{}, true},
+		{"Legacy invalid type", reference{Ref: "asdasd:#d742f4"}, RefSpec{}, true},
+		{"Structured", reference{Ref: "ocr:200",
+			RefSpec: RefSpec{Kind: RefColor, Color: "#000000", Tolerance: 4}},
+			RefSpec{Kind: RefColor, Color: "#000000", Tolerance: 4}, false},
+		{"Structured invalid kind", reference{
+			RefSpec: RefSpec{Kind: "hologram"}}, RefSpec{}, true},
+		{"Structured image without file", reference{
+			RefSpec: RefSpec{Kind: RefImage}}, RefSpec{}, true},
+		{"Structured invalid pattern", reference{
+			RefSpec: RefSpec{Kind: RefOCR, OCR: &OCROptions{Pattern: "("}}},
+			RefSpec{}, true},
+		{"Structured invalid tolerance", reference{
+			RefSpec: RefSpec{Kind: RefColor, Color: "#000000", Tolerance: 256}},
+			RefSpec{}, true},
+		{"Structured invalid threshold", reference{
+			RefSpec: RefSpec{Kind: RefOCR, Preprocess: &Preprocess{Threshold: -1}}},
+			RefSpec{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.r.spec()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("reference.spec() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reference.spec() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefSpec_String(t *testing.T) {
+
+	tests := []struct {
+		name string
+		s    RefSpec
+		want string
+	}{
+		{"Color", RefSpec{Kind: RefColor, Color: "#4268f4"}, "color:#4268f4"},
+		{"Image", RefSpec{Kind: RefImageM, File: "./x.png"}, "imageM:./x.png"},
+		{"OCR", RefSpec{Kind: RefOCR, OCR: &OCROptions{Width: 200}}, "ocr:200"},
+		{"Options", RefSpec{Kind: RefColor, Color: "#4268f4", Tolerance: 3},
+			"color:#4268f4 tolerance=3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.s.String(); got != tt.want {
+				t.Errorf("RefSpec.String() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_handleColor_tolerance(t *testing.T) {
+
+	ref1 := &reference{Name: "name1", RefSpec: RefSpec{Kind: RefColor,
+		Color: "#40f450", Tolerance: 2}}
+	ref2 := &reference{Name: "name2", RefSpec: RefSpec{Kind: RefColor,
+		Color: "#40f450", Tolerance: 1}}
+
+	col := color.RGBA{66, 244, 78, 255}
+
+	if got := handleColor(ref1, col); got != "name1" {
+		t.Errorf("handleColor() = %v, want name1", got)
+	}
+	if got := handleColor(ref2, col); got != "" {
+		t.Errorf("handleColor() = %v, want no match", got)
+	}
+}
+
+func Test_preprocess(t *testing.T) {
+
+	img := image.NewRGBA(image.Rect(5, 5, 7, 6))
+	img.Set(5, 5, color.RGBA{200, 100, 0, 255})
+	img.Set(6, 5, color.RGBA{20, 30, 40, 255})
+
+	tests := []struct {
+		name string
+		p    *Preprocess
+		want []color.RGBA
+	}{
+		{"None", nil, []color.RGBA{{200, 100, 0, 255}, {20, 30, 40, 255}}},
+		{"Grayscale", &Preprocess{Grayscale: true},
+			[]color.RGBA{{118, 118, 118, 255}, {28, 28, 28, 255}}},
+		{"Invert", &Preprocess{Invert: true},
+			[]color.RGBA{{55, 155, 255, 255}, {235, 225, 215, 255}}},
+		{"Threshold", &Preprocess{Threshold: 100},
+			[]color.RGBA{{255, 255, 255, 255}, {0, 0, 0, 255}}},
+		{"Threshold inverted", &Preprocess{Threshold: 100, Invert: true},
+			[]color.RGBA{{0, 0, 0, 255}, {255, 255, 255, 255}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := preprocess(img, tt.p)
+			b := out.Bounds()
+			for i, want := range tt.want {
+				got := color.RGBAModel.Convert(out.At(b.Min.X+i, b.Min.Y))
+				if got != want {
+					t.Errorf("preprocess() pixel %v = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package pokervision
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// ReloadableMatcher is a matcher which can replace its references while in
+// use. The ref file and the referenced images are loaded again on Reload and,
+// if a poll interval is given, periodically in the background. The
+// configuration is only replaced if any of these files changed.
+type ReloadableMatcher interface {
+	Matcher
+
+	// Reload loads the ref file and the referenced images again if any of
+	// them changed since they were last loaded. If loading or validation
+	// fails, the current configuration is kept.
+	Reload() error
+
+	// Close stops polling for changes.
+	Close()
+}
+
+// NewReloadableMatcher creates a new reloadable matcher from a JSON, YAML or
+// TOML encoded file. If interval is positive, the ref file and the referenced
+// images are checked for changes through the file loader every interval.
+func NewReloadableMatcher(refFile string,
+	interval time.Duration) (ReloadableMatcher, error) {
+
+	rm := &reloadableMatcher{
+		refFile: refFile,
+		done:    make(chan struct{}),
+	}
+
+	if err := rm.Reload(); err != nil {
+		return nil, err
+	}
+
+	if interval > 0 {
+		go rm.poll(interval)
+	}
+
+	return rm, nil
+}
+
+// generationProvider is implemented by matchers whose configuration can be
+// replaced, and by matchers wrapping them.
+type generationProvider interface {
+	generation() uint64
+}
+
+// configGeneration returns the generation of the configuration of m, which
+// changes whenever the configuration is replaced. Matchers which cannot
+// replace their configuration stay at generation 0.
+func configGeneration(m Matcher) uint64 {
+	if gp, ok := m.(generationProvider); ok {
+		return gp.generation()
+	}
+	return 0
+}
+
+// reloadableMatcher implements ReloadableMatcher by swapping the matcher it
+// delegates to.
+type reloadableMatcher struct {
+	refFile string
+
+	mu sync.RWMutex
+	m  *matcher
+
+	// files lists the files the current configuration was loaded from, sum
+	// is the fingerprint of their contents. gen counts the configurations
+	// swapped in.
+	files []string
+	sum   string
+	gen   uint64
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// current returns the matcher currently in use.
+func (rm *reloadableMatcher) current() *matcher {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return rm.m
+}
+
+// generation returns the number of configurations swapped in so far.
+func (rm *reloadableMatcher) generation() uint64 {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return rm.gen
+}
+
+// Match matches a source using the current configuration.
+func (rm *reloadableMatcher) Match(srcName string, img image.Image) string {
+	return rm.current().Match(srcName, img)
+}
+
+// VisualizeSource visualizes sources using the current configuration.
+func (rm *reloadableMatcher) VisualizeSource(img image.Image,
+	srcs []string) image.Image {
+	return rm.current().VisualizeSource(img, srcs)
+}
+
+// Reload loads the configuration again and swaps it in if it changed and is
+// valid.
+func (rm *reloadableMatcher) Reload() error {
+
+	rm.mu.RLock()
+	files, sum := rm.files, rm.sum
+	rm.mu.RUnlock()
+
+	// Keep the configuration if none of its files changed.
+	if sum != "" {
+		if cur, err := fingerprint(files); err == nil && cur == sum {
+			return nil
+		}
+	}
+
+	m, err := loadMatcher(rm.refFile)
+	if err != nil {
+		return err
+	}
+
+	if err := m.preloadImages(); err != nil {
+		return err
+	}
+
+	// Files which cannot be read now force a reload next time.
+	files = m.files()
+	sum, _ = fingerprint(files)
+
+	rm.mu.Lock()
+	rm.m, rm.files, rm.sum = m, files, sum
+	rm.gen++
+	rm.mu.Unlock()
+
+	return nil
+}
+
+// Close stops polling for changes.
+func (rm *reloadableMatcher) Close() {
+	rm.closeOnce.Do(func() {
+		close(rm.done)
+	})
+}
+
+// poll reloads the configuration every interval until closed.
+func (rm *reloadableMatcher) poll(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rm.done:
+			return
+		case <-ticker.C:
+			if err := rm.Reload(); err != nil {
+				log.Printf("error: Failed to reload ref file, keeping old one refFile=%v err=%v",
+					rm.refFile, err)
+			}
+		}
+	}
+}
+
+// preloadImages validates all sources and references and loads all reference
+// images and masks into memory, which together with the kNN models built by
+// loadMatcher makes the matcher independent of later changes to the image
+// files.
+func (im *matcher) preloadImages() error {
+
+	for i := range im.Srcs {
+		if err := im.Srcs[i].validate(); err != nil {
+			return err
+		}
+	}
+
+	for i := range im.Refs {
+		r := &im.Refs[i]
+
+		spec, err := r.spec()
+		if err != nil {
+			return fmt.Errorf("%v refName=%v", err, r.Name)
+		}
+
+		if !spec.hasFile() {
+			continue
+		}
+
+		img, err := loadImage(spec.File)
+		if err != nil {
+			return fmt.Errorf("%v refName=%v", err, r.Name)
+		}
+
+		r.img = img
+
+		if spec.Mask != "" {
+			mask, err := loadImage(spec.Mask)
+			if err != nil {
+				return fmt.Errorf("%v refName=%v", err, r.Name)
+			}
+
+			r.mask = mask
+		}
+	}
+
+	return nil
+}
+
+// files lists the files the matcher is loaded from: its ref files, the images
+// and masks of its references and the examples of its kNN references.
+func (im *matcher) files() []string {
+
+	files := append([]string(nil), im.refFiles...)
+	for i := range im.Refs {
+		spec, err := im.Refs[i].spec()
+		if err != nil {
+			continue
+		}
+
+		if spec.hasFile() {
+			files = append(files, spec.File)
+		}
+		if spec.Mask != "" {
+			files = append(files, spec.Mask)
+		}
+		if spec.Kind == RefKNN && spec.KNN != nil {
+			for _, e := range spec.KNN.Examples {
+				files = append(files, e.Files...)
+			}
+		}
+	}
+
+	return files
+}
+
+// fingerprint returns a hash of the names and contents of files, read through
+// the file loader.
+func fingerprint(files []string) (string, error) {
+
+	h := sha1.New()
+	for _, file := range files {
+		reader := fileLoader.Load(file)
+		if reader == nil {
+			return "", fmt.Errorf("Failed to load file %v", file)
+		}
+
+		fmt.Fprintf(h, "%v\x00", file)
+		n, err := io.Copy(h, reader)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "\x00%v\x00", n)
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,178 @@
+package pokervision
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeReloadFixture writes a ref file with a single image reference to dir.
+func writeReloadFixture(t *testing.T, dir string, refJSON string, imgFile string) {
+
+	refs := fmt.Sprintf(`{
+	"Srcs":[{"Name":"src","Src":[22,35,8,12],"Refs":["ref"]}],
+	"Refs":[{"Name":"ref","Ref":"image:%v"}]
+	}`, filepath.Join(dir, "ref.png"))
+	if refJSON != "" {
+		refs = refJSON
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "refs.json"), []byte(refs),
+		0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(imgFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "ref.png"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewReloadableMatcher(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "pokervision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("NewReloadableMatcher() failed to load master image. %v", err)
+	}
+
+	refFile := filepath.Join(dir, "refs.json")
+
+	// Does not exist.
+	if _, err := NewReloadableMatcher(refFile, 0); err == nil {
+		t.Errorf("NewReloadableMatcher() error = nil, want error")
+	}
+
+	writeReloadFixture(t, dir, "", "./testdata/blackVal.png")
+
+	m, err := NewReloadableMatcher(refFile, 0)
+	if err != nil {
+		t.Fatalf("NewReloadableMatcher() error = %v", err)
+	}
+	defer m.Close()
+
+	steps := []struct {
+		name    string
+		refJSON string
+		imgFile string
+		wantErr bool
+		wantRef string
+	}{
+		{"Initial", "", "", false, "ref"},
+		{"Image changed", "", "./testdata/redVal.png", false, ""},
+		{"Image restored", "", "./testdata/blackVal.png", false, "ref"},
+		{"Invalid image", "", "./testdata/invalidFile.png", true, "ref"},
+		{"Malformed ref file", "{", "./testdata/redVal.png", true, "ref"},
+		{"Invalid reference", `{
+			"Srcs":[{"Name":"src","Src":[22,35,8,12],"Refs":["ref"]}],
+			"Refs":[{"Name":"ref","Ref":"asdasd:#d742f4"}]
+			}`, "./testdata/redVal.png", true, "ref"},
+		{"Invalid source", `{
+			"Srcs":[{"Name":"src","Src":[22,35,8],"Refs":["ref"]}],
+			"Refs":[{"Name":"ref","Ref":"color:#d742f4"}]
+			}`, "./testdata/redVal.png", true, "ref"},
+	}
+	for _, st := range steps {
+		t.Run(st.name, func(t *testing.T) {
+			if st.imgFile != "" {
+				writeReloadFixture(t, dir, st.refJSON, st.imgFile)
+				if err := m.Reload(); (err != nil) != st.wantErr {
+					t.Errorf("Reload() error = %v, wantErr %v", err, st.wantErr)
+				}
+			}
+			if got := m.Match("src", img); got != st.wantRef {
+				t.Errorf("Match() = %v, want %v", got, st.wantRef)
+			}
+		})
+	}
+}
+
+func TestNewReloadableMatcher_poll(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "pokervision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("NewReloadableMatcher() failed to load master image. %v", err)
+	}
+
+	writeReloadFixture(t, dir, "", "./testdata/redVal.png")
+
+	m, err := NewReloadableMatcher(filepath.Join(dir, "refs.json"),
+		10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewReloadableMatcher() error = %v", err)
+	}
+	defer m.Close()
+
+	if got := m.Match("src", img); got != "" {
+		t.Errorf("Match() = %v, want no match", got)
+	}
+
+	writeReloadFixture(t, dir, "", "./testdata/blackVal.png")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for m.Match("src", img) != "ref" {
+		if time.Now().After(deadline) {
+			t.Fatalf("Match() did not pick up the changed reference")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReloadableMatcher_Reload_unchanged(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "pokervision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeReloadFixture(t, dir, "", "./testdata/blackVal.png")
+
+	m, err := NewReloadableMatcher(filepath.Join(dir, "refs.json"), 0)
+	if err != nil {
+		t.Fatalf("NewReloadableMatcher() error = %v", err)
+	}
+	defer m.Close()
+
+	steps := []struct {
+		name        string
+		imgFile     string
+		wantSwapped bool
+	}{
+		{"Nothing written", "", false},
+		{"Same contents written", "./testdata/blackVal.png", false},
+		{"Image changed", "./testdata/redVal.png", true},
+	}
+	for _, st := range steps {
+		t.Run(st.name, func(t *testing.T) {
+			before, _ := asMatcher(m)
+			if st.imgFile != "" {
+				writeReloadFixture(t, dir, "", st.imgFile)
+			}
+			if err := m.Reload(); err != nil {
+				t.Fatalf("Reload() error = %v", err)
+			}
+			if after, _ := asMatcher(m); (after != before) != st.wantSwapped {
+				t.Errorf("Reload() swapped = %v, want %v", after != before,
+					st.wantSwapped)
+			}
+		})
+	}
+}
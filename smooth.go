@@ -0,0 +1,153 @@
+package pokervision
+
+import (
+	"image"
+	"sync"
+	"time"
+)
+
+// Stability configures how long a source must keep a value before a smoothed
+// reader reports it. A value is stable once it was matched in Frames
+// consecutive frames or for Duration since it first appeared, whichever comes
+// first. If neither is positive, values are stable at once.
+type Stability struct {
+	Frames   int
+	Duration time.Duration
+}
+
+// stable reports whether a value seen in count consecutive frames for elapsed
+// time is stable.
+func (st Stability) stable(count int, elapsed time.Duration) bool {
+
+	if st.Frames <= 0 && st.Duration <= 0 {
+		return true
+	}
+
+	return (st.Frames > 0 && count >= st.Frames) ||
+		(st.Duration > 0 && elapsed >= st.Duration)
+}
+
+// SmoothedReader matches sources in consecutive frames and only reports a new
+// value for a source once it is stable, which hides misreads while cards are
+// dealt or chips slide.
+type SmoothedReader interface {
+
+	// Read matches a source in a frame captured at time t and returns the
+	// stabilized value. Frames must be read in order.
+	Read(srcName string, img image.Image, t time.Time) string
+
+	// Raw returns the value matched in the last frame read for a source.
+	Raw(srcName string) string
+
+	// Value returns the stabilized value of a source. It is empty until a
+	// value has been stable.
+	Value(srcName string) string
+
+	// Reset forgets the values of all sources.
+	Reset()
+}
+
+// NewSmoothedReader creates a reader stabilizing the values of the sources of
+// m. Sources use the stability given in perSource, or def if they are not
+// listed.
+func NewSmoothedReader(m Matcher, def Stability,
+	perSource map[string]Stability) SmoothedReader {
+
+	sr := &smoothedReader{
+		m:         m,
+		def:       def,
+		perSource: make(map[string]Stability, len(perSource)),
+		states:    make(map[string]*smoothState),
+	}
+	for srcName, st := range perSource {
+		sr.perSource[srcName] = st
+	}
+
+	return sr
+}
+
+// smoothState tracks the values of a source.
+type smoothState struct {
+
+	// raw is the value of the last frame, which has been seen in count
+	// consecutive frames since the frame at time since.
+	raw   string
+	count int
+	since time.Time
+
+	// stable is the last stable value.
+	stable string
+}
+
+// smoothedReader implements SmoothedReader.
+type smoothedReader struct {
+	m         Matcher
+	def       Stability
+	perSource map[string]Stability
+
+	mu     sync.Mutex
+	states map[string]*smoothState
+}
+
+// Read matches a source in a frame and returns the stabilized value.
+func (sr *smoothedReader) Read(srcName string, img image.Image,
+	t time.Time) string {
+
+	value := sr.m.Match(srcName, img)
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	s := sr.states[srcName]
+	if s == nil {
+		s = new(smoothState)
+		sr.states[srcName] = s
+	}
+
+	if s.count == 0 || value != s.raw {
+		s.raw, s.count, s.since = value, 1, t
+	} else {
+		s.count++
+	}
+
+	st, ok := sr.perSource[srcName]
+	if !ok {
+		st = sr.def
+	}
+	if st.stable(s.count, t.Sub(s.since)) {
+		s.stable = s.raw
+	}
+
+	return s.stable
+}
+
+// Raw returns the value of the last frame read for a source.
+func (sr *smoothedReader) Raw(srcName string) string {
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	if s := sr.states[srcName]; s != nil {
+		return s.raw
+	}
+	return ""
+}
+
+// Value returns the stabilized value of a source.
+func (sr *smoothedReader) Value(srcName string) string {
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	if s := sr.states[srcName]; s != nil {
+		return s.stable
+	}
+	return ""
+}
+
+// Reset forgets the values of all sources.
+func (sr *smoothedReader) Reset() {
+	sr.mu.Lock()
+	sr.states = make(map[string]*smoothState)
+	sr.mu.Unlock()
+}
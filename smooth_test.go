@@ -0,0 +1,108 @@
+package pokervision
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+	"time"
+)
+
+func TestNewSmoothedReader(t *testing.T) {
+
+	m, err := NewMatcherBuilder().
+		AddPixel("src", image.Pt(0, 0), "white", "black").
+		AddPixel("fast", image.Pt(0, 0), "white", "black").
+		AddColor("white", color.White, 0).
+		AddColor("black", color.Black, 0).
+		Build()
+	if err != nil {
+		t.Fatalf("MatcherBuilder.Build() error = %v", err)
+	}
+
+	frames := make(map[string]image.Image)
+	for name, c := range map[string]color.Color{"white": color.White,
+		"black": color.Black, "red": color.RGBA{255, 0, 0, 255}} {
+		img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+		draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{},
+			draw.Src)
+		frames[name] = img
+	}
+
+	type step struct {
+		frame string
+		ms    int
+		want  string
+	}
+	tests := []struct {
+		name    string
+		srcName string
+		def     Stability
+		steps   []step
+	}{
+		{"Immediate", "src", Stability{}, []step{
+			{"white", 0, "white"},
+			{"black", 10, "black"},
+			{"red", 20, ""},
+		}},
+		{"Frames", "src", Stability{Frames: 3}, []step{
+			{"white", 0, ""},
+			{"white", 10, ""},
+			{"white", 20, "white"},
+			{"black", 30, "white"},
+			{"white", 40, "white"},
+			{"black", 50, "white"},
+			{"black", 60, "white"},
+			{"black", 70, "black"},
+			{"red", 80, "black"},
+		}},
+		{"Duration", "src", Stability{Duration: 100 * time.Millisecond},
+			[]step{
+				{"white", 0, ""},
+				{"white", 50, ""},
+				{"white", 100, "white"},
+				{"black", 110, "white"},
+				{"black", 210, "black"},
+			}},
+		{"Frames or duration", "src",
+			Stability{Frames: 3, Duration: 100 * time.Millisecond}, []step{
+				{"white", 0, ""},
+				{"white", 100, "white"},
+				{"black", 110, "white"},
+				{"black", 120, "white"},
+				{"black", 130, "black"},
+			}},
+		{"Per source", "fast", Stability{Frames: 3}, []step{
+			{"white", 0, ""},
+			{"white", 10, "white"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := NewSmoothedReader(m, tt.def,
+				map[string]Stability{"fast": {Frames: 2}})
+
+			start := time.Now()
+			for i, s := range tt.steps {
+				ts := start.Add(time.Duration(s.ms) * time.Millisecond)
+				if got := sr.Read(tt.srcName, frames[s.frame], ts); got != s.want {
+					t.Errorf("SmoothedReader.Read() step %v = %v, want %v", i,
+						got, s.want)
+				}
+				if got := sr.Value(tt.srcName); got != s.want {
+					t.Errorf("SmoothedReader.Value() step %v = %v, want %v", i,
+						got, s.want)
+				}
+				if want := m.Match(tt.srcName, frames[s.frame]); sr.Raw(tt.srcName) != want {
+					t.Errorf("SmoothedReader.Raw() step %v = %v, want %v", i,
+						sr.Raw(tt.srcName), want)
+				}
+			}
+
+			sr.Reset()
+			if sr.Value(tt.srcName) != "" || sr.Raw(tt.srcName) != "" {
+				t.Errorf("SmoothedReader.Reset() kept values")
+			}
+		})
+	}
+}
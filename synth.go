@@ -0,0 +1,330 @@
+package pokervision
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"math/rand"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// SynthOptions configures how synthetic table images are rendered and
+// distorted. Distortions are applied in the order offset, blur, noise and
+// JPEG compression.
+type SynthOptions struct {
+
+	// TextColor is the color of rendered text. Defaults to black.
+	TextColor color.Color
+
+	// Offset moves the whole image. Pixels which are uncovered are black.
+	Offset image.Point
+
+	// Blur is the radius (0-16) of a box blur.
+	Blur int
+
+	// Noise is the largest amount (0-255) added to or subtracted from each
+	// color component of each pixel.
+	Noise int
+
+	// JPEGQuality (1-100) encodes the image as JPEG and decodes it again, to
+	// add compression artifacts. 0 disables JPEG compression.
+	JPEGQuality int
+
+	// Seed seeds the random noise, so equal options give equal images.
+	Seed int64
+}
+
+// validate checks that the options are well-formed.
+func (o *SynthOptions) validate() error {
+
+	if o.Blur < 0 || o.Blur > 16 {
+		return fmt.Errorf("Illegal blur radius %v", o.Blur)
+	}
+
+	if o.Noise < 0 || o.Noise > 255 {
+		return fmt.Errorf("Illegal noise %v", o.Noise)
+	}
+
+	if o.JPEGQuality < 0 || o.JPEGQuality > 100 {
+		return fmt.Errorf("Illegal JPEG quality %v", o.JPEGQuality)
+	}
+
+	return nil
+}
+
+// Synthesize renders a synthetic table image, showing the given values of the
+// sources of m on top of background. values maps source names to the value
+// Match is expected to return, so together they make a Sample for RunCorpus,
+// see SliceSamples.
+//
+// For each source the first reference returning the value is drawn:
+// reference images are drawn at the top left corner of regions, colors fill
+// pixels and regions, pixel signatures set the pixels of pixel sets and kNN
+// references draw their first example of the value. If no reference returns
+// the value, or it is an OCR reference, the value is rendered as text centered
+// in the region. Sources are drawn in the order of the ref file.
+func Synthesize(m Matcher, background image.Image, values map[string]string,
+	opts SynthOptions) (image.Image, error) {
+
+	im, ok := asMatcher(m)
+	if !ok {
+		return nil, errors.New("Unsupported matcher type")
+	}
+
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	for srcName := range values {
+		if im.findSource(srcName) == nil {
+			return nil, fmt.Errorf("Unknown source srcName=%v", srcName)
+		}
+	}
+
+	b := background.Bounds()
+	out := image.NewRGBA(b)
+	draw.Draw(out, b, background, b.Min, draw.Src)
+
+	for i := range im.Srcs {
+		s := &im.Srcs[i]
+		value, ok := values[s.Name]
+		if !ok {
+			continue
+		}
+
+		if err := im.drawSource(out, s, value, opts); err != nil {
+			return nil, fmt.Errorf("%v srcName=%v", err, s.Name)
+		}
+	}
+
+	var img image.Image = out
+	if opts.Offset != (image.Point{}) {
+		img = offsetImage(img, opts.Offset)
+	}
+	if opts.Blur > 0 {
+		img = boxBlur(img, opts.Blur)
+	}
+	if opts.Noise > 0 {
+		img = addNoise(img, opts.Noise, opts.Seed)
+	}
+	if opts.JPEGQuality > 0 {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img,
+			&jpeg.Options{Quality: opts.JPEGQuality}); err != nil {
+			return nil, err
+		}
+
+		var err error
+		if img, err = jpeg.Decode(&buf); err != nil {
+			return nil, err
+		}
+	}
+
+	return img, nil
+}
+
+// drawSource draws a value of a source onto img.
+func (im *matcher) drawSource(img *image.RGBA, s *source, value string,
+	opts SynthOptions) error {
+
+	if err := s.validate(); err != nil {
+		return err
+	}
+
+	for _, r := range im.candidates(s) {
+		spec, err := r.spec()
+		if err != nil {
+			return fmt.Errorf("%v refName=%v", err, r.Name)
+		}
+
+		if spec.Kind == RefKNN {
+			if file := knnExampleFile(spec, value); file != "" {
+				refImg, err := loadImage(file)
+				if err != nil {
+					return fmt.Errorf("%v refName=%v", err, r.Name)
+				}
+				return drawRegion(img, s, refImg)
+			}
+			continue
+		}
+
+		if r.result() != value || spec.Kind == RefOCR {
+			continue
+		}
+
+		switch {
+		case spec.hasFile():
+			refImg, err := r.loadImage(spec.File)
+			if err != nil {
+				return fmt.Errorf("%v refName=%v", err, r.Name)
+			}
+			return drawRegion(img, s, refImg)
+
+		case spec.Kind == RefPixels && len(spec.Colors) > 0:
+			pts := s.points()
+			if len(pts) != len(spec.Colors) {
+				return fmt.Errorf("Expected %v colors refName=%v", len(pts),
+					r.Name)
+			}
+			for i, p := range pts {
+				c, _ := parseHTMLColor(spec.Colors[i])
+				img.Set(p.X, p.Y, c)
+			}
+			return nil
+
+		case spec.Color != "":
+			c, _ := parseHTMLColor(spec.Color)
+			switch {
+			case s.isPixelSet():
+				for _, p := range s.points() {
+					img.Set(p.X, p.Y, c)
+				}
+			case len(s.Src) == 2:
+				img.Set(s.Src[0], s.Src[1], c)
+			default:
+				draw.Draw(img, sourceRect(s), image.NewUniform(c),
+					image.Point{}, draw.Src)
+			}
+			return nil
+		}
+	}
+
+	if len(s.Src) != 4 {
+		return fmt.Errorf("No reference draws value=%v", value)
+	}
+
+	drawText(img, sourceRect(s), value, opts.TextColor)
+	return nil
+}
+
+// knnExampleFile returns the first example file of a label of a kNN
+// reference.
+func knnExampleFile(spec RefSpec, label string) string {
+	if spec.KNN == nil {
+		return ""
+	}
+	for _, e := range spec.KNN.Examples {
+		if e.Label == label && len(e.Files) > 0 {
+			return e.Files[0]
+		}
+	}
+	return ""
+}
+
+// sourceRect returns the rectangle of a region source.
+func sourceRect(s *source) image.Rectangle {
+	return image.Rect(s.Src[0], s.Src[1], s.Src[0]+s.Src[2],
+		s.Src[1]+s.Src[3])
+}
+
+// drawRegion draws an image at the top left corner of a region source,
+// clipped to the region. Transparent pixels keep the background.
+func drawRegion(img *image.RGBA, s *source, refImg image.Image) error {
+
+	if len(s.Src) != 4 {
+		return errors.New("Cannot draw image on pixel source")
+	}
+
+	draw.Draw(img, sourceRect(s), refImg, refImg.Bounds().Min, draw.Over)
+	return nil
+}
+
+// drawText renders text centered in a rectangle.
+func drawText(img *image.RGBA, rect image.Rectangle, text string,
+	c color.Color) {
+
+	if c == nil {
+		c = color.Black
+	}
+
+	face := basicfont.Face7x13
+	metrics := face.Metrics()
+	height := (metrics.Ascent + metrics.Descent).Ceil()
+
+	d := &font.Drawer{
+		Dst:  img.SubImage(rect).(*image.RGBA),
+		Src:  image.NewUniform(c),
+		Face: face,
+	}
+
+	width := d.MeasureString(text).Ceil()
+	d.Dot = fixed.P(rect.Min.X+(rect.Dx()-width)/2,
+		rect.Min.Y+(rect.Dy()-height)/2+metrics.Ascent.Ceil())
+	d.DrawString(text)
+}
+
+// offsetImage moves an image by an offset, keeping its bounds. Uncovered
+// pixels are black.
+func offsetImage(img image.Image, offset image.Point) image.Image {
+
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	draw.Draw(out, b, image.NewUniform(color.Black), image.Point{}, draw.Src)
+	draw.Draw(out, b.Add(offset), img, b.Min, draw.Src)
+
+	return out
+}
+
+// boxBlur replaces each pixel by the average of the pixels within radius which
+// are inside the image.
+func boxBlur(img image.Image, radius int) image.Image {
+
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+
+	for x := b.Min.X; x < b.Max.X; x++ {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			var sr, sg, sb, sa, n uint32
+			for dx := -radius; dx <= radius; dx++ {
+				for dy := -radius; dy <= radius; dy++ {
+					p := image.Pt(x+dx, y+dy)
+					if !p.In(b) {
+						continue
+					}
+					r, g, bl, a := img.At(p.X, p.Y).RGBA()
+					sr, sg, sb, sa = sr+r, sg+g, sb+bl, sa+a
+					n++
+				}
+			}
+			out.Set(x, y, color.RGBA64{uint16(sr / n), uint16(sg / n),
+				uint16(sb / n), uint16(sa / n)})
+		}
+	}
+
+	return out
+}
+
+// addNoise adds uniform random noise of up to amount to each color component,
+// keeping the alpha.
+func addNoise(img image.Image, amount int, seed int64) image.Image {
+
+	rnd := rand.New(rand.NewSource(seed))
+	noisy := func(v, max uint8) uint8 {
+		n := int(v) + rnd.Intn(2*amount+1) - amount
+		if n < 0 {
+			return 0
+		} else if n > int(max) {
+			return max
+		}
+		return uint8(n)
+	}
+
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			out.SetRGBA(x, y, color.RGBA{noisy(c.R, c.A), noisy(c.G, c.A),
+				noisy(c.B, c.A), c.A})
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,201 @@
+package pokervision
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"reflect"
+	"testing"
+)
+
+// synthMatcher returns a matcher with a region, a pixel and a text source.
+func synthMatcher(t *testing.T) Matcher {
+
+	m, err := NewMatcherBuilder().
+		AddRegion("srcImg", image.Rect(22, 35, 30, 47), "black", "red").
+		AddPixel("srcColor", image.Pt(9, 28), "blue", "purple").
+		AddRegion("srcText", image.Rect(40, 0, 80, 20), "text").
+		AddReference("black", RefSpec{Kind: RefImage,
+			File: "./testdata/blackVal.png"}).
+		AddReference("red", RefSpec{Kind: RefImage,
+			File: "./testdata/redVal.png"}).
+		AddColor("blue", color.RGBA{0x42, 0x68, 0xf4, 255}, 0).
+		AddColor("purple", color.RGBA{0xd7, 0x42, 0xf4, 255}, 0).
+		AddOCR("text", OCROptions{}).
+		Build()
+	if err != nil {
+		t.Fatalf("MatcherBuilder.Build() error = %v", err)
+	}
+
+	return m
+}
+
+// whiteImage returns a white image of the given size.
+func whiteImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	return img
+}
+
+func TestSynthesize(t *testing.T) {
+
+	m := synthMatcher(t)
+	bg := whiteImage(100, 60)
+
+	tests := []struct {
+		name   string
+		values map[string]string
+	}{
+		{"Black", map[string]string{"srcImg": "black", "srcColor": "purple"}},
+		{"Red", map[string]string{"srcImg": "red", "srcColor": "blue"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := Synthesize(m, bg, tt.values, SynthOptions{})
+			if err != nil {
+				t.Fatalf("Synthesize() error = %v", err)
+			}
+
+			got := make(map[string]string)
+			for srcName := range tt.values {
+				got[srcName] = m.Match(srcName, img)
+			}
+			if !reflect.DeepEqual(got, tt.values) {
+				t.Errorf("matcher.Match() = %v, want %v", got, tt.values)
+			}
+		})
+	}
+
+	// The background is not changed.
+	if bg.At(22, 35) != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("Synthesize() changed the background")
+	}
+}
+
+func TestSynthesize_text(t *testing.T) {
+
+	img, err := Synthesize(synthMatcher(t), whiteImage(100, 60),
+		map[string]string{"srcText": "Pot: 120"}, SynthOptions{
+			TextColor: color.RGBA{255, 0, 0, 255},
+		})
+	if err != nil {
+		t.Fatalf("Synthesize() error = %v", err)
+	}
+
+	red := 0
+	b := img.Bounds()
+	for x := b.Min.X; x < b.Max.X; x++ {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			if img.At(x, y) == (color.RGBA{255, 0, 0, 255}) {
+				if !image.Pt(x, y).In(image.Rect(40, 0, 80, 20)) {
+					t.Fatalf("Synthesize() drew text outside region at %v,%v",
+						x, y)
+				}
+				red++
+			}
+		}
+	}
+	if red == 0 {
+		t.Errorf("Synthesize() drew no text")
+	}
+}
+
+func TestSynthesize_distortions(t *testing.T) {
+
+	m := synthMatcher(t)
+	bg := whiteImage(100, 60)
+	values := map[string]string{"srcImg": "black"}
+
+	plain, err := Synthesize(m, bg, values, SynthOptions{})
+	if err != nil {
+		t.Fatalf("Synthesize() error = %v", err)
+	}
+
+	t.Run("Offset", func(t *testing.T) {
+		img, err := Synthesize(m, bg, values,
+			SynthOptions{Offset: image.Pt(2, 1)})
+		if err != nil {
+			t.Fatalf("Synthesize() error = %v", err)
+		}
+		if got := m.Match("srcImg", img); got != "" {
+			t.Errorf("matcher.Match() = %v, want no match", got)
+		}
+		if img.At(26, 37) != plain.At(24, 36) {
+			t.Errorf("Synthesize() did not move the image")
+		}
+		if img.At(0, 0) != (color.RGBA{0, 0, 0, 255}) {
+			t.Errorf("Synthesize() uncovered pixel = %v, want black",
+				img.At(0, 0))
+		}
+	})
+
+	t.Run("Blur", func(t *testing.T) {
+		img, err := Synthesize(m, bg, values, SynthOptions{Blur: 1})
+		if err != nil {
+			t.Fatalf("Synthesize() error = %v", err)
+		}
+		if img.At(0, 0) != (color.RGBA{255, 255, 255, 255}) {
+			t.Errorf("Synthesize() blurred uniform area to %v", img.At(0, 0))
+		}
+		if got := m.Match("srcImg", img); got != "" {
+			t.Errorf("matcher.Match() = %v, want no match", got)
+		}
+	})
+
+	t.Run("Noise", func(t *testing.T) {
+		opts := SynthOptions{Noise: 20, Seed: 7}
+		img1, err := Synthesize(m, bg, values, opts)
+		if err != nil {
+			t.Fatalf("Synthesize() error = %v", err)
+		}
+		img2, _ := Synthesize(m, bg, values, opts)
+		if !reflect.DeepEqual(img1, img2) {
+			t.Errorf("Synthesize() differs for equal seeds")
+		}
+
+		_, stats, _ := Diff(plain, img1, DiffAbsolute)
+		if stats.Differing == 0 || stats.MaxDelta > 20*0x101 {
+			t.Errorf("Synthesize() noise stats = %+v", stats)
+		}
+	})
+
+	t.Run("JPEG", func(t *testing.T) {
+		img, err := Synthesize(m, bg, values, SynthOptions{JPEGQuality: 50})
+		if err != nil {
+			t.Fatalf("Synthesize() error = %v", err)
+		}
+		if img.Bounds() != bg.Bounds() {
+			t.Errorf("Synthesize() bounds = %v, want %v", img.Bounds(),
+				bg.Bounds())
+		}
+		if _, stats, _ := Diff(plain, img, DiffAbsolute); stats.Equal() {
+			t.Errorf("Synthesize() added no JPEG artifacts")
+		}
+	})
+}
+
+func TestSynthesize_errors(t *testing.T) {
+
+	m := synthMatcher(t)
+	bg := whiteImage(100, 60)
+
+	tests := []struct {
+		name   string
+		values map[string]string
+		opts   SynthOptions
+	}{
+		{"Unknown source", map[string]string{"missing": "x"}, SynthOptions{}},
+		{"Unknown color", map[string]string{"srcColor": "green"},
+			SynthOptions{}},
+		{"Blur", nil, SynthOptions{Blur: -1}},
+		{"Noise", nil, SynthOptions{Noise: 256}},
+		{"JPEG", nil, SynthOptions{JPEGQuality: 101}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Synthesize(m, bg, tt.values, tt.opts); err == nil {
+				t.Errorf("Synthesize() expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package pokervision
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// sourceTemplate describes a group of sources which is repeated on the screen,
+// such as the stack, bet and cards of a seat. The coordinates of the sources
+// are relative to the origin of each instance.
+type sourceTemplate struct {
+	Name string   `yaml:"Name"`
+	Srcs []source `yaml:"Srcs"`
+}
+
+// templateInstance places a template at a list of origins. The sources of the
+// n'th origin (counting from 1) are named "<Prefix><n>.<source name>". Prefix
+// defaults to the name of the template.
+type templateInstance struct {
+	Template string  `yaml:"Template"`
+	Prefix   string  `json:",omitempty" yaml:"Prefix,omitempty" toml:",omitempty"`
+	Origins  [][]int `yaml:"Origins"`
+}
+
+// expandTemplates creates the sources described by the template instances.
+// Sources defined explicitly replace instantiated sources of the same name.
+func (im *matcher) expandTemplates() error {
+
+	if len(im.Instances) == 0 {
+		return nil
+	}
+
+	generated := new(matcher)
+	for _, inst := range im.Instances {
+
+		t := im.findTemplate(inst.Template)
+		if t == nil {
+			return fmt.Errorf("Template does not exist template=%v",
+				inst.Template)
+		}
+
+		prefix := inst.Prefix
+		if prefix == "" {
+			prefix = t.Name
+		}
+
+		for i, origin := range inst.Origins {
+			if len(origin) != 2 {
+				return fmt.Errorf(
+					"Illegal origin - len(Origin) must be 2 template=%v origin=%v",
+					t.Name, origin)
+			}
+
+			name := prefix + strconv.Itoa(i+1)
+			srcs := make([]source, len(t.Srcs))
+			for j, s := range t.Srcs {
+				srcs[j] = s.offset(name+"."+s.Name, origin[0], origin[1])
+			}
+			generated.merge(&matcher{Srcs: srcs})
+		}
+	}
+
+	generated.merge(&matcher{Srcs: im.Srcs})
+	im.Srcs = generated.Srcs
+	im.Instances = nil
+
+	return nil
+}
+
+// findTemplate finds a template given its name.
+func (im *matcher) findTemplate(name string) *sourceTemplate {
+	for i := range im.Templates {
+		if im.Templates[i].Name == name {
+			return &im.Templates[i]
+		}
+	}
+
+	return nil
+}
+
+// offset returns a renamed copy of the source moved by (dx,dy).
+func (s source) offset(name string, dx, dy int) source {
+
+	src := append([]int(nil), s.Src...)
+	if len(src) >= 2 {
+		src[0] += dx
+		src[1] += dy
+	}
+
+	var points [][]int
+	for _, p := range s.Points {
+		p = append([]int(nil), p...)
+		if len(p) == 2 {
+			p[0] += dx
+			p[1] += dy
+		}
+		points = append(points, p)
+	}
+
+	grid := append([]int(nil), s.Grid...)
+	if len(grid) >= 2 {
+		grid[0] += dx
+		grid[1] += dy
+	}
+
+	s.Name, s.Src, s.Points, s.Grid = name, src, points, grid
+
+	return s
+}
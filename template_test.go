@@ -0,0 +1,83 @@
+package pokervision
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_matcher_expandTemplates(t *testing.T) {
+
+	img, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("matcher.expandTemplates() failed to load master image. %v", err)
+	}
+
+	m, err := loadMatcher("./testdata/seats.json")
+	if err != nil {
+		t.Fatalf("matcher.expandTemplates() failed to load ref file. %v", err)
+	}
+
+	tests := []struct {
+		srcName string
+		wantSrc []int
+		wantRef string
+	}{
+		{"seat1.color", []int{9, 28}, "refColor2"},
+		{"seat1.img", []int{113, 107, 8, 12}, ""},
+		{"seat2.color", []int{9, 28}, "refColor2"},
+		{"seat2.img", []int{22, 35, 8, 12}, "refImg2"},
+		{"hero1.img", []int{22, 35, 8, 12}, "refImg2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.srcName, func(t *testing.T) {
+			s := m.findSource(tt.srcName)
+			if s == nil {
+				t.Fatalf("matcher.findSource() = nil, want source")
+			}
+			if !reflect.DeepEqual(s.Src, tt.wantSrc) {
+				t.Errorf("source.Src = %v, want %v", s.Src, tt.wantSrc)
+			}
+			if got := m.Match(tt.srcName, img); got != tt.wantRef {
+				t.Errorf("matcher.Match() = %v, want %v", got, tt.wantRef)
+			}
+		})
+	}
+
+	// Explicit sources replace instantiated ones.
+	if s := m.findSource("seat1.color"); !reflect.DeepEqual(s.Refs,
+		[]string{"refColor2"}) {
+		t.Errorf("source.Refs = %v, want [refColor2]", s.Refs)
+	}
+
+	// The template itself is left untouched.
+	if s := m.findTemplate("seat"); s.Srcs[0].Src[0] != 0 {
+		t.Errorf("template source = %v, want [0 0]", s.Srcs[0].Src)
+	}
+}
+
+func Test_matcher_expandTemplates_errors(t *testing.T) {
+
+	tests := []struct {
+		name string
+		m    *matcher
+	}{
+		{"Missing template", &matcher{
+			Instances: []templateInstance{{"seat", "", [][]int{{0, 0}}}},
+		}},
+		{"Illegal origin", &matcher{
+			Templates: []sourceTemplate{{"seat", nil}},
+			Instances: []templateInstance{{"seat", "", [][]int{{0}}}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.m.expandTemplates(); err == nil {
+				t.Errorf("matcher.expandTemplates() error = nil, want error")
+			}
+		})
+	}
+
+	if _, err := NewMatcher("./testdata/seatsMissing.json"); err == nil {
+		t.Errorf("NewMatcher() error = nil, want error")
+	}
+}
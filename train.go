@@ -0,0 +1,533 @@
+package pokervision
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sample is a screenshot labeled with the values expected from its sources.
+type Sample struct {
+
+	// Name identifies the sample in reports, usually by its file name.
+	Name string
+
+	// Image is the screenshot.
+	Image image.Image
+
+	// Labels maps source names to the value Match is expected to return.
+	Labels map[string]string
+}
+
+// SampleSource reads labeled samples one at a time, so that a corpus need
+// not fit into memory.
+type SampleSource interface {
+
+	// Next returns the next sample, or io.EOF after the last sample.
+	Next() (Sample, error)
+}
+
+// LoadSamples loads labeled screenshots from a JSON encoded sample file or a
+// directory, see OpenSamples. Files are loaded through the file loader. Use
+// OpenSamples to read large corpora.
+func LoadSamples(sampleFile string) ([]Sample, error) {
+
+	src, err := OpenSamples(sampleFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []Sample
+	for {
+		sample, err := src.Next()
+		if err == io.EOF {
+			return samples, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+}
+
+// OpenSamples opens a JSON encoded file listing the image file and the labels
+// of each sample, e.g.
+//
+//	{"Samples":[{"File":"shot1.png","Labels":{"seat1.card1":"As"}}]}
+//
+// or a directory of PNG screenshots, each labeled by a JSON encoded file of
+// the same name, e.g. shot1.png and shot1.json holding
+//
+//	{"seat1.card1":"As"}
+//
+// Screenshots in a directory are read in the order of the last number in
+// their name, other files are skipped. The images are loaded through the file
+// loader when their sample is read.
+func OpenSamples(sampleFile string) (SampleSource, error) {
+
+	if fi, err := os.Stat(sampleFile); err == nil && fi.IsDir() {
+		return openSampleDir(sampleFile)
+	}
+
+	// Read JSON file containing samples.
+	reader := fileLoader.Load(sampleFile)
+	if reader == nil {
+		return nil, errors.New("Failed to load sample file")
+	}
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(reader)
+
+	var sf struct {
+		Samples []struct {
+			File   string
+			Labels map[string]string
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &sf); err != nil {
+		return nil, err
+	}
+
+	entries := make([]sampleEntry, len(sf.Samples))
+	for i, s := range sf.Samples {
+		file := s.File
+		entries[i] = sampleEntry{
+			name:   file,
+			labels: s.Labels,
+			load:   func() (image.Image, error) { return loadImage(file) },
+		}
+	}
+
+	return &entrySamples{entries: entries}, nil
+}
+
+// openSampleDir opens a directory of PNG screenshots and their label files.
+func openSampleDir(dir string) (SampleSource, error) {
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []sampleEntry
+	for _, fi := range files {
+		if fi.IsDir() || !isPNGFile(fi.Name()) {
+			continue
+		}
+
+		file := filepath.Join(dir, fi.Name())
+		labels, err := loadLabels(strings.TrimSuffix(file,
+			filepath.Ext(file)) + ".json")
+		if err != nil {
+			return nil, fmt.Errorf("%v sample=%v", err, file)
+		}
+
+		entries = append(entries, sampleEntry{
+			name:   file,
+			labels: labels,
+			load:   func() (image.Image, error) { return loadImage(file) },
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return lessFrameName(entries[i].name, entries[j].name)
+	})
+
+	return &entrySamples{entries: entries}, nil
+}
+
+// loadLabels loads the labels of a screenshot from a JSON encoded file
+// mapping source names to values.
+func loadLabels(labelFile string) (map[string]string, error) {
+
+	reader := fileLoader.Load(labelFile)
+	if reader == nil {
+		return nil, errors.New("Failed to load label file")
+	}
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(reader)
+
+	var labels map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &labels); err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+// SliceSamples returns a sample source reading samples held in memory, e.g.
+// synthesized ones.
+func SliceSamples(samples []Sample) SampleSource {
+
+	entries := make([]sampleEntry, len(samples))
+	for i, s := range samples {
+		img := s.Image
+		entries[i] = sampleEntry{
+			name:   s.Name,
+			labels: s.Labels,
+			load:   func() (image.Image, error) { return img, nil },
+		}
+	}
+
+	return &entrySamples{entries: entries}
+}
+
+// sampleEntry is a sample whose image is decoded when it is read.
+type sampleEntry struct {
+	name   string
+	labels map[string]string
+	load   func() (image.Image, error)
+}
+
+// entrySamples implements SampleSource over a list of samples.
+type entrySamples struct {
+	entries []sampleEntry
+	next    int
+}
+
+// Next returns the next sample.
+func (es *entrySamples) Next() (Sample, error) {
+
+	if es.next >= len(es.entries) {
+		return Sample{}, io.EOF
+	}
+	e := es.entries[es.next]
+	es.next++
+
+	img, err := e.load()
+	if err != nil {
+		return Sample{}, fmt.Errorf("%v sample=%v", err, e.name)
+	}
+
+	return Sample{Name: e.name, Image: img, Labels: e.labels}, nil
+}
+
+// TrainOptions configures how references are learned from samples.
+type TrainOptions struct {
+
+	// Kind is the kind of the references learned for regions, RefImage or
+	// RefImageM. Defaults to RefImage. Pixels always yield color references.
+	Kind RefKind
+
+	// Tolerance is the largest difference (0-255) of a color component for
+	// two crops to be considered the same. The learned references use it as
+	// their tolerance.
+	Tolerance int
+
+	// Dir is the directory the learned reference images are saved to.
+	Dir string
+}
+
+// LabelConflict describes crops of a source which are the same but were
+// labeled with different values.
+type LabelConflict struct {
+
+	// Source is the name of the source.
+	Source string
+
+	// Reference is the name of the reference learned from the crops. It
+	// stands for the most frequent label.
+	Reference string
+
+	// Labels are the conflicting labels, sorted.
+	Labels []string
+
+	// Samples are the names of the samples holding the crops, in order.
+	Samples []string
+}
+
+// String describes the conflict.
+func (c LabelConflict) String() string {
+	return fmt.Sprintf("Conflicting labels srcName=%v refName=%v labels=%v samples=%v",
+		c.Source, c.Reference, c.Labels, c.Samples)
+}
+
+// TrainResult holds the references learned by Train.
+type TrainResult struct {
+
+	// Matcher holds the sources and references of the trained matcher, with
+	// the learned references added. The reference images are held in memory.
+	Matcher Matcher
+
+	// Images maps the files of the learned image references to their images.
+	Images map[string]image.Image
+
+	// Conflicts lists the crops which were labeled with different values.
+	Conflicts []LabelConflict
+
+	// Samples is the number of samples read.
+	Samples int
+}
+
+// Save writes the learned reference images as PNG files and the sources and
+// references of the trained matcher to refFile, encoded in the given format.
+func (tr *TrainResult) Save(refFile string, format RefFormat) error {
+
+	files := make([]string, 0, len(tr.Images))
+	for file := range tr.Images {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := writePNG(file, tr.Images[file]); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Create(refFile)
+	if err != nil {
+		return err
+	}
+
+	if err := ExportMatcher(f, tr.Matcher, format); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// writePNG writes an image to a PNG file.
+func writePNG(file string, img image.Image) error {
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// cluster is a group of crops of a source which are the same.
+type cluster struct {
+	img     image.Image
+	color   color.Color
+	labels  map[string]int
+	order   []string
+	samples []string
+}
+
+// label returns the most frequent label of the cluster. Ties go to the label
+// seen first.
+func (c *cluster) label() string {
+	best := c.order[0]
+	for _, l := range c.order[1:] {
+		if c.labels[l] > c.labels[best] {
+			best = l
+		}
+	}
+	return best
+}
+
+// Train learns references from labeled samples. The crops of each labeled
+// source of m are clustered, and a reference is learned from the first crop of
+// each cluster. The reference is named "<source>.<label>", with a counter
+// appended if a label has several clusters, and its value is the label. Its
+// image is saved in opts.Dir under the name of the reference. The
+// learned references replace references of the same name in m and are added
+// to the references of the source. Clusters whose crops were labeled with
+// different values are reported as conflicts and stand for the most frequent
+// label. The samples are read once, and only the crops of a sample are kept
+// after it was read.
+func Train(m Matcher, samples SampleSource, opts TrainOptions) (*TrainResult,
+	error) {
+
+	im, ok := asMatcher(m)
+	if !ok {
+		return nil, errors.New("Unsupported matcher type")
+	}
+
+	if opts.Kind == "" {
+		opts.Kind = RefImage
+	}
+	if opts.Kind != RefImage && opts.Kind != RefImageM {
+		return nil, fmt.Errorf("Cannot learn references of kind=%v", opts.Kind)
+	}
+	if opts.Tolerance < 0 || opts.Tolerance > 255 {
+		return nil, fmt.Errorf("Illegal tolerance %v", opts.Tolerance)
+	}
+
+	out := &matcher{Refs: append([]reference(nil), im.Refs...)}
+	tr := &TrainResult{Matcher: out, Images: make(map[string]image.Image)}
+
+	// Cluster the crops of all sources, one sample at a time.
+	clusters := make([][]*cluster, len(im.Srcs))
+	for {
+		sample, err := samples.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		tr.Samples++
+
+		for i := range im.Srcs {
+			clusters[i], err = clusterCrop(clusters[i], &im.Srcs[i], sample,
+				opts)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for i, s := range im.Srcs {
+		s.Refs = append([]string(nil), s.Refs...)
+
+		counts := make(map[string]int)
+		for _, c := range clusters[i] {
+			label := c.label()
+			counts[label]++
+
+			r := reference{Name: s.Name + "." + label, Value: label}
+			if counts[label] > 1 {
+				r.Name += "." + strconv.Itoa(counts[label])
+			}
+
+			if c.img != nil {
+				r.Kind = opts.Kind
+				r.File = tr.imageFile(opts.Dir, r.Name)
+				r.img = c.img
+				tr.Images[r.File] = c.img
+			} else {
+				r.Kind = RefColor
+				r.Color = string(htmlColor(c.color))
+			}
+			r.Tolerance = opts.Tolerance
+			out.merge(&matcher{Refs: []reference{r}})
+
+			if !containsString(s.Refs, r.Name) {
+				s.Refs = append(s.Refs, r.Name)
+			}
+
+			if len(c.labels) > 1 {
+				labels := append([]string(nil), c.order...)
+				sort.Strings(labels)
+				tr.Conflicts = append(tr.Conflicts, LabelConflict{
+					Source:    s.Name,
+					Reference: r.Name,
+					Labels:    labels,
+					Samples:   c.samples,
+				})
+			}
+		}
+
+		out.Srcs = append(out.Srcs, s)
+	}
+
+	return tr, nil
+}
+
+// imageFile returns the file of the image of a learned reference. Names which
+// only differ in characters not allowed in file names get a counter appended,
+// so that their images do not overwrite each other.
+func (tr *TrainResult) imageFile(dir, refName string) string {
+
+	base := filepath.Join(dir, fileName(refName))
+	file := base + ".png"
+	for n := 2; tr.Images[file] != nil; n++ {
+		file = base + "_" + strconv.Itoa(n) + ".png"
+	}
+
+	return file
+}
+
+// clusterCrop crops a source from a sample labeling it and adds the crop to
+// the cluster of crops which are the same, or to a new cluster.
+func clusterCrop(clusters []*cluster, s *source, sample Sample,
+	opts TrainOptions) ([]*cluster, error) {
+
+	label, ok := sample.Labels[s.Name]
+	if !ok {
+		return clusters, nil
+	}
+
+	srcImg, srcColor, isPixel, ok := grabSource(s, sample.Image)
+	if !ok {
+		return nil, fmt.Errorf("Illegal source srcName=%v", s.Name)
+	}
+
+	// Copy the crop, since the sub image shares the pixels of the sample.
+	if !isPixel {
+		b := srcImg.Bounds()
+		crop := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(crop, crop.Bounds(), srcImg, b.Min, draw.Src)
+		srcImg = crop
+	}
+
+	// Find the cluster of the crop.
+	var c *cluster
+	for _, other := range clusters {
+		if sameCrop(other, srcImg, srcColor, opts) {
+			c = other
+			break
+		}
+	}
+	if c == nil {
+		c = &cluster{img: srcImg, color: srcColor,
+			labels: make(map[string]int)}
+		clusters = append(clusters, c)
+	}
+
+	if c.labels[label] == 0 {
+		c.order = append(c.order, label)
+	}
+	c.labels[label]++
+	c.samples = append(c.samples, sample.Name)
+
+	return clusters, nil
+}
+
+// sameCrop reports whether a crop belongs to a cluster.
+func sameCrop(c *cluster, srcImg image.Image, srcColor color.Color,
+	opts TrainOptions) bool {
+
+	if c.img == nil {
+		return colorDelta(c.color, srcColor) <= uint32(opts.Tolerance)
+	}
+
+	if opts.Kind == RefImageM {
+		return compareImagesMonochrome(c.img, srcImg)
+	}
+
+	return compareImagesTolerance(c.img, srcImg, uint32(opts.Tolerance))
+}
+
+// illegalFileChars matches characters which are replaced in file names.
+var illegalFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// fileName turns a reference name into a file name.
+func fileName(name string) string {
+	return illegalFileChars.ReplaceAllString(name, "_")
+}
+
+// containsString reports whether strs contains s.
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
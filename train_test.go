@@ -0,0 +1,312 @@
+package pokervision
+
+import (
+	"image"
+	"image/draw"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTrain(t *testing.T) {
+
+	master, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("Train() failed to load master image. %v", err)
+	}
+
+	// Copy of the master image showing the red value in place of the black
+	// value.
+	b := master.Bounds()
+	swapped := image.NewRGBA(b)
+	draw.Draw(swapped, b, master, b.Min, draw.Src)
+	draw.Draw(swapped, image.Rect(22, 35, 30, 47), master, image.Pt(46, 27),
+		draw.Src)
+
+	m, err := NewMatcher("./testdata/train.json")
+	if err != nil {
+		t.Fatalf("Train() failed to load ref file. %v", err)
+	}
+
+	samples := []Sample{
+		{"master", master, map[string]string{"srcColor": "purple",
+			"srcImg": "black", "srcImg2": "red"}},
+		{"swapped", swapped, map[string]string{"srcImg": "red"}},
+		{"master again", master, map[string]string{"srcImg": "black"}},
+	}
+
+	tr, err := Train(m, SliceSamples(samples), TrainOptions{Dir: "refs"})
+	if err != nil {
+		t.Fatalf("Train() error = %v", err)
+	}
+	if tr.Samples != len(samples) {
+		t.Errorf("Train() samples = %v, want %v", tr.Samples, len(samples))
+	}
+	if len(tr.Conflicts) != 0 {
+		t.Errorf("Train() conflicts = %v, want none", tr.Conflicts)
+	}
+
+	wantFiles := []string{filepath.Join("refs", "srcImg.black.png"),
+		filepath.Join("refs", "srcImg.red.png"),
+		filepath.Join("refs", "srcImg2.red.png")}
+	for _, file := range wantFiles {
+		if tr.Images[file] == nil {
+			t.Errorf("Train() images = %v, want %v", tr.Images, file)
+		}
+	}
+
+	im, _ := asMatcher(tr.Matcher)
+	if s := im.findSource("srcImg2"); !reflect.DeepEqual(s.Refs,
+		[]string{"refImg2", "srcImg2.red"}) {
+		t.Errorf("Train() refs = %v, want [refImg2 srcImg2.red]", s.Refs)
+	}
+
+	tests := []struct {
+		srcName string
+		img     image.Image
+		want    string
+	}{
+		{"srcColor", master, "purple"},
+		{"srcImg", master, "black"},
+		{"srcImg", swapped, "red"},
+		{"srcImg2", master, "refImg2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.srcName, func(t *testing.T) {
+			if got := tr.Matcher.Match(tt.srcName, tt.img); got != tt.want {
+				t.Errorf("matcher.Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrain_conflicts(t *testing.T) {
+
+	samples, err := LoadSamples("./testdata/samples.json")
+	if err != nil {
+		t.Fatalf("LoadSamples() error = %v", err)
+	}
+	if len(samples) != 2 || samples[0].Labels["srcColor"] != "purple" {
+		t.Fatalf("LoadSamples() = %v, want 2 samples", samples)
+	}
+
+	m, err := NewMatcher("./testdata/train.json")
+	if err != nil {
+		t.Fatalf("Train() failed to load ref file. %v", err)
+	}
+
+	tr, err := Train(m, SliceSamples(samples), TrainOptions{Kind: RefImageM})
+	if err != nil {
+		t.Fatalf("Train() error = %v", err)
+	}
+
+	want := []LabelConflict{{
+		Source:    "srcImg",
+		Reference: "srcImg.black",
+		Labels:    []string{"black", "dark"},
+		Samples:   []string{"./testdata/master.png", "./testdata/master.png"},
+	}}
+	if !reflect.DeepEqual(tr.Conflicts, want) {
+		t.Errorf("Train() conflicts = %v, want %v", tr.Conflicts, want)
+	}
+}
+
+func TestOpenSamples(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "pokervision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Images are only loaded when their sample is read.
+	sampleFile := filepath.Join(dir, "samples.json")
+	manifest := `{"Samples":[
+		{"File":"./testdata/master.png","Labels":{"srcImg":"black"}},
+		{"File":"./testdata/noExist.png","Labels":{"srcImg":"red"}}]}`
+	if err := ioutil.WriteFile(sampleFile, []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := OpenSamples(sampleFile)
+	if err != nil {
+		t.Fatalf("OpenSamples() error = %v", err)
+	}
+
+	sample, err := src.Next()
+	if err != nil || sample.Name != "./testdata/master.png" ||
+		sample.Image == nil || sample.Labels["srcImg"] != "black" {
+		t.Errorf("SampleSource.Next() = %+v, %v", sample, err)
+	}
+	if _, err := src.Next(); err == nil || err == io.EOF {
+		t.Errorf("SampleSource.Next() error = %v, want load error", err)
+	}
+	if _, err := src.Next(); err != io.EOF {
+		t.Errorf("SampleSource.Next() error = %v, want io.EOF", err)
+	}
+
+	if _, err := OpenSamples(filepath.Join(dir, "noExist.json")); err == nil {
+		t.Errorf("OpenSamples() error = nil, want error")
+	}
+}
+
+func TestOpenSamples_dir(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "pokervision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b, err := ioutil.ReadFile("./testdata/master.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"shot10.png":  string(b),
+		"shot10.json": `{"srcImg":"red"}`,
+		"shot9.png":   string(b),
+		"shot9.json":  `{"srcImg":"black"}`,
+		"notes.txt":   "skipped",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data),
+			0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	samples, err := LoadSamples(dir)
+	if err != nil {
+		t.Fatalf("LoadSamples() error = %v", err)
+	}
+	if len(samples) != 2 || samples[0].Labels["srcImg"] != "black" ||
+		samples[1].Labels["srcImg"] != "red" || samples[0].Image == nil {
+		t.Errorf("LoadSamples() = %v, want shot9 and shot10", samples)
+	}
+
+	// Screenshots must be labeled.
+	if err := os.Remove(filepath.Join(dir, "shot9.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenSamples(dir); err == nil {
+		t.Errorf("OpenSamples() error = nil, want error for missing labels")
+	}
+}
+
+func TestTrain_fileNames(t *testing.T) {
+
+	master, err := loadImage("./testdata/master.png")
+	if err != nil {
+		t.Errorf("Train() failed to load master image. %v", err)
+	}
+
+	b := master.Bounds()
+	swapped := image.NewRGBA(b)
+	draw.Draw(swapped, b, master, b.Min, draw.Src)
+	draw.Draw(swapped, image.Rect(22, 35, 30, 47), master, image.Pt(46, 27),
+		draw.Src)
+
+	m, err := NewMatcher("./testdata/train.json")
+	if err != nil {
+		t.Fatalf("Train() failed to load ref file. %v", err)
+	}
+
+	// Both labels map to the file name srcImg.a_b.
+	samples := []Sample{
+		{"master", master, map[string]string{"srcImg": "a b"}},
+		{"swapped", swapped, map[string]string{"srcImg": "a_b"}},
+	}
+
+	tr, err := Train(m, SliceSamples(samples), TrainOptions{Dir: "refs"})
+	if err != nil {
+		t.Fatalf("Train() error = %v", err)
+	}
+
+	wantFiles := []string{filepath.Join("refs", "srcImg.a_b.png"),
+		filepath.Join("refs", "srcImg.a_b_2.png")}
+	if len(tr.Images) != len(wantFiles) {
+		t.Errorf("Train() images = %v, want %v", tr.Images, wantFiles)
+	}
+	for _, file := range wantFiles {
+		if tr.Images[file] == nil {
+			t.Errorf("Train() images = %v, want %v", tr.Images, file)
+		}
+	}
+
+	tests := []struct {
+		img  image.Image
+		want string
+	}{
+		{master, "a b"},
+		{swapped, "a_b"},
+	}
+	for _, tt := range tests {
+		if got := tr.Matcher.Match("srcImg", tt.img); got != tt.want {
+			t.Errorf("matcher.Match() = %v, want %v", got, tt.want)
+		}
+	}
+}
+
+func TestTrainResult_Save(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "pokervision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	samples, err := LoadSamples("./testdata/samples.json")
+	if err != nil {
+		t.Fatalf("LoadSamples() error = %v", err)
+	}
+
+	m, err := NewMatcher("./testdata/train.json")
+	if err != nil {
+		t.Fatalf("Train() failed to load ref file. %v", err)
+	}
+
+	tr, err := Train(m, SliceSamples(samples[:1]), TrainOptions{Dir: filepath.Join(dir, "img")})
+	if err != nil {
+		t.Fatalf("Train() error = %v", err)
+	}
+
+	refFile := filepath.Join(dir, "trained.yaml")
+	if err := tr.Save(refFile, FormatYAML); err != nil {
+		t.Fatalf("TrainResult.Save() error = %v", err)
+	}
+
+	saved, err := NewMatcher(refFile)
+	if err != nil {
+		t.Fatalf("NewMatcher() error = %v", err)
+	}
+	if got := saved.Match("srcImg", samples[0].Image); got != "black" {
+		t.Errorf("matcher.Match() = %v, want black", got)
+	}
+}
+
+func TestTrain_errors(t *testing.T) {
+
+	m, err := NewMatcher("./testdata/train.json")
+	if err != nil {
+		t.Fatalf("Train() failed to load ref file. %v", err)
+	}
+
+	tests := []struct {
+		name string
+		opts TrainOptions
+	}{
+		{"Kind", TrainOptions{Kind: RefOCR}},
+		{"Tolerance", TrainOptions{Tolerance: 256}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Train(m, SliceSamples(nil), tt.opts); err == nil {
+				t.Errorf("Train() error = nil, want error")
+			}
+		})
+	}
+}
@@ -2,9 +2,6 @@ package pokervision
 
 import (
 	"bytes"
-	"encoding/hex"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"image"
 	"image/color"
@@ -14,8 +11,6 @@ import (
 	"io/ioutil"
 	"log"
 	"regexp"
-	"strconv"
-	"strings"
 
 	"github.com/nfnt/resize"
 	"github.com/otiai10/gosseract"
@@ -56,25 +51,52 @@ type Matcher interface {
 	VisualizeSource(img image.Image, srcs []string) image.Image
 }
 
-// NewMatcher creates a new matcher from a JSON encoded file.
+// NewMatcher creates a new matcher from a JSON, YAML or TOML encoded file.
 func NewMatcher(refFile string) (Matcher, error) {
 
-	// Read JSON file containing references.
-	reader := fileLoader.Load(refFile)
-	if reader == nil {
-		return nil, errors.New("Failed to load ref file")
+	m, err := loadMatcher(refFile)
+	if err != nil {
+		return nil, err
 	}
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(reader)
 
-	// Fill data from JSON into matcher.
-	var m matcher
-	err := json.Unmarshal(buf.Bytes(), &m)
+	return m, nil
+}
+
+// loadMatcher loads a matcher from a ref file, including the ref
+// files it refers to, the sources instantiated from templates and the
+// examples of kNN references.
+func loadMatcher(refFile string) (*matcher, error) {
+
+	m, err := loadRefFile(refFile, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	return &m, nil
+	if err := m.expandTemplates(); err != nil {
+		return nil, err
+	}
+
+	if err := m.loadKNNModels(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// matcherProvider is implemented by matchers wrapping a matcher.
+type matcherProvider interface {
+	current() *matcher
+}
+
+// asMatcher returns the matcher behind m.
+func asMatcher(m Matcher) (*matcher, bool) {
+	switch m := m.(type) {
+	case *matcher:
+		return m, true
+	case matcherProvider:
+		return m.current(), true
+	}
+	return nil, false
 }
 
 // subImager provides an interface for image-types with the SubImage() function.
@@ -84,23 +106,75 @@ type subImager interface {
 }
 
 // source describes a rectangle or point on the sceen that should be sampled.
+// Instead of Src, a source may sample a set of pixels given by Points and
+// Grid.
 type source struct {
-	Name string
-	Src  []int
-	Refs []string
+	Name string `yaml:"Name"`
+	Src  []int  `json:",omitempty" yaml:"Src,omitempty" toml:",omitempty"`
+
+	// Points lists pixels (x, y) sampled by a pixel set source.
+	Points [][]int `json:",omitempty" yaml:"Points,omitempty" toml:",omitempty"`
+
+	// Grid samples the centers of a grid of cells covering a rectangle,
+	// described by 6 ints: x, y, width, height, columns and rows.
+	Grid []int `json:",omitempty" yaml:"Grid,omitempty" toml:",omitempty"`
+
+	Refs []string `yaml:"Refs"`
+
+	// Classify scores all references and returns the best match, instead of
+	// returning the first reference which matches.
+	Classify bool `json:",omitempty" yaml:"Classify,omitempty" toml:",omitempty"`
+
+	// MinMargin is the smallest difference (0-1) between the scores of the
+	// best match and the runner-up for a classifying source to match. Below
+	// it, the match is considered ambiguous and no reference is returned.
+	MinMargin float64 `json:",omitempty" yaml:"MinMargin,omitempty" toml:",omitempty"`
 }
 
 // reference describes a reference color or image to be compared against.
 type reference struct {
-	Name string
-	Ref  string
+	Name string `yaml:"Name"`
+
+	// Value is returned by Match if the reference matches. It defaults to the
+	// name and allows several references to stand for the same value.
+	Value string `json:",omitempty" yaml:"Value,omitempty" toml:",omitempty"`
+
+	// Ref is the definition in the legacy prefix notation. It is only used if
+	// Kind is not set.
+	Ref string `json:",omitempty" yaml:"Ref,omitempty" toml:",omitempty"`
+
+	RefSpec `yaml:",inline"`
+
+	// img is the preloaded reference image, if any.
+	img image.Image
+
+	// mask is the preloaded mask image, if any.
+	mask image.Image
+
+	// knn holds the preloaded examples of a kNN reference, if any.
+	knn *knnModel
+}
+
+// result returns what Match returns if the reference matches.
+func (r *reference) result() string {
+	if r.Value != "" {
+		return r.Value
+	}
+	return r.Name
 }
 
 // matcher allows for finding color or image matches. The comparisons are
 // described by the JSON format (same name).
 type matcher struct {
-	Srcs []source
-	Refs []reference
+	Include   []string           `json:",omitempty" yaml:"Include,omitempty" toml:",omitempty"`
+	Templates []sourceTemplate   `json:",omitempty" yaml:"Templates,omitempty" toml:",omitempty"`
+	Instances []templateInstance `json:",omitempty" yaml:"Instances,omitempty" toml:",omitempty"`
+	Srcs      []source           `yaml:"Srcs"`
+	Refs      []reference        `yaml:"Refs"`
+
+	// refFiles lists the ref file the matcher was loaded from and the files
+	// it includes.
+	refFiles []string
 }
 
 func (im *matcher) VisualizeSource(src image.Image, srcs []string) image.Image {
@@ -115,7 +189,13 @@ func (im *matcher) VisualizeSource(src image.Image, srcs []string) image.Image {
 
 		col := color.RGBA{255, 0, 0, 255}
 
-		if len(src.Src) == 2 {
+		if src.isPixelSet() {
+
+			for _, p := range src.points() {
+				mutImg.Set(p.X, p.Y, col)
+			}
+
+		} else if len(src.Src) == 2 {
 
 			mutImg.Set(src.Src[0], src.Src[1], col)
 
@@ -145,10 +225,6 @@ func (im *matcher) VisualizeSource(src image.Image, srcs []string) image.Image {
 // Match matches a source (specified by srcName) with its assiocitated references.
 func (im *matcher) Match(srcName string, img image.Image) (ref string) {
 
-	var isPixel bool
-	var srcImg image.Image
-	var srcColor color.Color
-
 	// Locate source
 	s := im.findSource(srcName)
 	if s == nil {
@@ -156,57 +232,30 @@ func (im *matcher) Match(srcName string, img image.Image) (ref string) {
 		return ""
 	}
 
-	// Grap pixels/image from source.
-	switch len(s.Src) {
-
-	// Pixel (described by 2 ints).
-	case 2:
-
-		// Grab pixel.
-		srcColor = img.At(s.Src[0], s.Src[1])
-		isPixel = true
-
-	// Image (described by 4 ints).
-	case 4:
-
-		rect := image.Rect(
-			s.Src[0],          // X
-			s.Src[1],          // Y
-			s.Src[0]+s.Src[2], // X+width
-			s.Src[1]+s.Src[3]) // Y+height
-
-		// Grab subimage.
-		srcImg = img.(subImager).SubImage(rect)
-		isPixel = false
+	// Score all references in classification mode.
+	if s.Classify {
+		return im.matchBest(s, img)
+	}
 
-	default:
-		log.Printf(`error: illegal source - len(Src) must be 2 or 4 srcName=%v`,
-			srcName)
+	// Grap pixels/image from source.
+	srcImg, srcColor, isPixel, ok := grabSource(s, img)
+	if !ok {
 		return ""
 	}
 
 	// Compare against each reference.
-	for _, r := range im.Refs {
-
-		// Determine if this ref should be considered.
-		skip := true
-		for _, rName := range s.Refs {
-
-			// The source is referring to this reference.
-			if r.Name == rName {
+	for _, r := range im.candidates(s) {
 
-				// Stop looking.
-				skip = false
-				break
-			}
-		}
-		// This reference should NOT be considered.
-		if skip {
-			continue
+		spec, err := r.spec()
+		if err != nil {
+			log.Printf("error: %v refName=%v", err, r.Name)
+			return ""
 		}
 
+		switch spec.Kind {
+
 		// Handle color.
-		if strings.HasPrefix(r.Ref, "color:") {
+		case RefColor:
 			// Color cannot be compared against image.
 			if !isPixel {
 				log.Printf(`error: Cannot compare image against color srcName=%v
@@ -219,8 +268,8 @@ func (im *matcher) Match(srcName string, img image.Image) (ref string) {
 				return match
 			}
 
-			// Handle OCR.
-		} else if strings.HasPrefix(r.Ref, "ocr:") {
+		// Handle OCR.
+		case RefOCR:
 
 			// Image cannot be compared against pixel.
 			if isPixel {
@@ -229,19 +278,13 @@ func (im *matcher) Match(srcName string, img image.Image) (ref string) {
 				return ""
 			}
 
-			args := ""
-			if len(r.Ref) > 4 {
-				args = r.Ref[4:]
-			}
-
-			match := handleOCR(srcImg, args)
-
+			match := recognizeText(preprocess(srcImg, spec.Preprocess), spec.OCR)
 			if len(match) != 0 {
 				return match
 			}
 
-			// Handle Image (monochrome or not).
-		} else if strings.HasPrefix(r.Ref, "image") {
+		// Handle Image (monochrome or not).
+		case RefImage, RefImageM:
 
 			// Image cannot be compared against pixel.
 			if isPixel {
@@ -254,10 +297,64 @@ func (im *matcher) Match(srcName string, img image.Image) (ref string) {
 			if len(match) != 0 {
 				return match
 			}
-		} else {
-			log.Printf("error: Invalid reference type refName=%v ref=%v",
-				r.Name, r.Ref)
-			return ""
+
+		// Handle edges.
+		case RefEdges:
+
+			// Edges cannot be computed for pixel.
+			if isPixel {
+				log.Printf(`error: Cannot compare pixel against edges srcName=%v
+				refName=%v`, srcName, r.Name)
+				return ""
+			}
+
+			match := handleEdges(&r, srcImg)
+			if len(match) != 0 {
+				return match
+			}
+
+		// Handle kNN classification.
+		case RefKNN:
+
+			// Image cannot be classified for pixel.
+			if isPixel {
+				log.Printf(`error: Cannot classify pixel srcName=%v
+				refName=%v`, srcName, r.Name)
+				return ""
+			}
+
+			match := handleKNN(&r, srcImg)
+			if len(match) != 0 {
+				return match
+			}
+
+		// Handle histogram and dominant color.
+		case RefHistogram, RefDominant:
+
+			// Histogram cannot be computed for pixel.
+			if isPixel {
+				log.Printf(`error: Cannot compare pixel against histogram srcName=%v
+				refName=%v`, srcName, r.Name)
+				return ""
+			}
+
+			match := handleHistogram(&r, srcImg)
+			if len(match) != 0 {
+				return match
+			}
+
+		// Handle pixel signature.
+		case RefPixels:
+
+			srcColors := []color.Color{srcColor}
+			if !isPixel {
+				srcColors = imageColors(srcImg)
+			}
+
+			match := handlePixels(&r, srcColors)
+			if len(match) != 0 {
+				return match
+			}
 		}
 	}
 
@@ -266,6 +363,74 @@ func (im *matcher) Match(srcName string, img image.Image) (ref string) {
 
 }
 
+// grabSource grabs the pixel or image described by a source from img. The
+// pixels of a pixel set are grabbed as an image one pixel high. ok is false if
+// the source is illegal.
+func grabSource(s *source, img image.Image) (srcImg image.Image,
+	srcColor color.Color, isPixel bool, ok bool) {
+
+	// Pixel set (described by Points and Grid).
+	if s.isPixelSet() {
+		if err := s.validate(); err != nil {
+			log.Printf("error: %v", err)
+			return nil, nil, false, false
+		}
+
+		return samplePixels(s, img), nil, false, true
+	}
+
+	switch len(s.Src) {
+
+	// Pixel (described by 2 ints).
+	case 2:
+
+		// Grab pixel.
+		srcColor = img.At(s.Src[0], s.Src[1])
+		isPixel = true
+
+	// Image (described by 4 ints).
+	case 4:
+
+		rect := image.Rect(
+			s.Src[0],          // X
+			s.Src[1],          // Y
+			s.Src[0]+s.Src[2], // X+width
+			s.Src[1]+s.Src[3]) // Y+height
+
+		// Grab subimage.
+		srcImg = img.(subImager).SubImage(rect)
+		isPixel = false
+
+	default:
+		log.Printf(`error: illegal source - len(Src) must be 2 or 4 srcName=%v`,
+			s.Name)
+		return nil, nil, false, false
+	}
+
+	return srcImg, srcColor, isPixel, true
+}
+
+// candidates returns the references a source refers to, in the order they
+// appear in Refs.
+func (im *matcher) candidates(s *source) []reference {
+
+	var refs []reference
+	for _, r := range im.Refs {
+
+		// Determine if this ref should be considered.
+		for _, rName := range s.Refs {
+
+			// The source is referring to this reference.
+			if r.Name == rName {
+				refs = append(refs, r)
+				break
+			}
+		}
+	}
+
+	return refs
+}
+
 // findSource finds a source given its name.
 func (im *matcher) findSource(srcName string) *source {
 	for _, s := range im.Srcs {
@@ -280,47 +445,55 @@ func (im *matcher) findSource(srcName string) *source {
 // handleImage handles a comparison with a image (monochrome or not).
 func handleImage(r *reference, srcImg image.Image) string {
 
-	var file string
-
-	// Get filename from ref string.
-	if strings.HasPrefix(r.Ref, "image:") {
-
-		file = r.Ref[len("image:"):]
-
-	} else if strings.HasPrefix(r.Ref, "imageM:") {
-
-		file = r.Ref[len("imageM:"):]
-
-	} else {
-
+	spec, err := r.spec()
+	if err != nil || !spec.isImage() {
 		log.Printf("error: Illegal image type refName=%v ref=%v", r.Name, r.Ref)
-
+		return ""
 	}
 
 	// Load reference image.
-	refImg, err := loadImage(file)
+	refImg, err := r.loadImage(spec.File)
 	if err != nil {
 		log.Printf("error: %v refName='%v'", err, r.Name)
 		return ""
 	}
 
+	// Load mask.
+	mask, err := r.loadMask(spec, refImg)
+	if err != nil {
+		log.Printf("error: %v refName='%v'", err, r.Name)
+		return ""
+	}
+
+	refImg = preprocess(refImg, spec.Preprocess)
+	srcImg = preprocess(srcImg, spec.Preprocess)
+
 	// Compare the images.
-	if strings.HasPrefix(r.Ref, "imageM:") {
+	if mask != nil || spec.Monochrome != nil {
+
+		// Masked or configured monochrome comparison.
+		if compareImagesMasked(refImg, srcImg, mask, spec) {
+
+			// Match.
+			return r.result()
+		}
+
+	} else if spec.Kind == RefImageM {
 
 		// Monochrome comparison.
 		if compareImagesMonochrome(refImg, srcImg) {
 
 			// Match.
-			return r.Name
+			return r.result()
 		}
 
 	} else {
 
 		// Normal comparison.
-		if compareImages(refImg, srcImg) {
+		if compareImagesTolerance(refImg, srcImg, uint32(spec.Tolerance)) {
 
 			// Match.
-			return r.Name
+			return r.result()
 		}
 	}
 
@@ -330,76 +503,61 @@ func handleImage(r *reference, srcImg image.Image) string {
 
 // handleColor handles a comparison with a color reference.
 func handleColor(r *reference, srcColor color.Color) string {
-	const preLen = len("color:")
 
-	// Assert HTML color format (this check allows the following slicing).
-	if len(r.Ref) != (preLen + 7) {
-		log.Printf(`error: invalid color, expected HTML color
-				refName=%v color=%v`, r.Name, r.Ref)
-		return ""
+	spec, err := r.spec()
+	if err == nil && spec.Kind != RefColor {
+		err = fmt.Errorf("Not a color reference")
 	}
-
-	b, err := hex.DecodeString(r.Ref[preLen+1:])
 	if err != nil {
 		log.Printf(`error: invalid color, expected HTML color
-				refName=%v color=%v`, r.Name, r.Ref)
+				refName=%v color=%v err=%v`, r.Name, r.Ref, err)
 		return ""
 	}
 
+	c, _ := parseHTMLColor(spec.Color)
+	tol := uint32(spec.Tolerance)
+
 	// Compare colors.
 	red, green, blue, _ := srcColor.RGBA()
 
-	if (red/256) == uint32(b[0]) &&
-		(green/256) == uint32(b[1]) &&
-		(blue/256) == uint32(b[2]) {
+	if absDiff(red/256, uint32(c.R)) <= tol &&
+		absDiff(green/256, uint32(c.G)) <= tol &&
+		absDiff(blue/256, uint32(c.B)) <= tol {
 		// Match.
 
-		return r.Name
+		return r.result()
 	}
 
 	// No match.
 	return ""
 }
 
-// handleOCR handles a OCR operation
+// handleOCR handles a OCR operation described by legacy OCR arguments.
 func handleOCR(srcImg image.Image, args string) string {
 
-	/*var charsOnly = false
-	var numbersOnly = false*/
-
-	strs := strings.Split(args, ",")
-	for i, arg := range strs {
-		switch i {
-
-		// Image width.
-		case 0:
-			if len(arg) == 0 {
-				break
-			}
+	opts, err := parseOCRArgs(args)
+	if err != nil {
+		log.Printf("error: %v", err)
+		return ""
+	}
 
-			w, err := strconv.Atoi(arg)
-			if err != nil {
-				log.Printf("error: Illegal OCR arg width=%v", arg)
-				return ""
-			}
+	return recognizeText(srcImg, opts)
+}
 
-			if w > 0 {
-				srcImg = resize.Resize(uint(w), 0, srcImg, resize.Lanczos2)
-			}
+// recognizeText runs OCR on an image and returns the text without spaces and
+// line breaks. If the text does not match the pattern of the options, the
+// empty string is returned.
+func recognizeText(srcImg image.Image, opts *OCROptions) string {
+	return filterText(ocrRaw(prepareOCR(srcImg, opts)), opts)
+}
 
-			// Characters only.
-			/*case 1:
-				if strings.ToLower(arg) == "y" {
-					charsOnly = true
-				} else if strings.ToLower(arg) == "n" {
-					numbersOnly = true
-				}
-			}*/
-		}
-	}
+// filterText removes spaces and line breaks from the raw text recognized by
+// OCR. If the text does not match the pattern of the options, the empty string
+// is returned.
+func filterText(out string, opts *OCROptions) string {
 
-	client, _ := gosseract.NewClient()
-	out, _ := client.Image(srcImg).Out()
+	/*var charsOnly = false
+	var numbersOnly = false*/
 
 	/*
 		if charsOnly {
@@ -427,12 +585,44 @@ func handleOCR(srcImg image.Image, args string) string {
 
 	regx := regexp.MustCompile("[ \\n]")
 	out = regx.ReplaceAllString(out, "")
+
+	if opts != nil && opts.Pattern != "" {
+		if ok, _ := regexp.MatchString(opts.Pattern, out); !ok {
+			return ""
+		}
+	}
+
 	return out //strings.ToLower(out)
 }
 
+// prepareOCR prepares an image for OCR as described by the OCR options.
+func prepareOCR(srcImg image.Image, opts *OCROptions) image.Image {
+
+	if opts != nil && opts.Width > 0 {
+		srcImg = resize.Resize(uint(opts.Width), 0, srcImg, resize.Lanczos2)
+	}
+
+	return srcImg
+}
+
+// ocrRaw runs OCR on an image and returns the unprocessed text.
+func ocrRaw(srcImg image.Image) string {
+	client, _ := gosseract.NewClient()
+	out, _ := client.Image(srcImg).Out()
+	return out
+}
+
 // compareImages compares two images pixel by pixel. Images must be of same size
 // and have identical values for all pixel in order for function to return true.
 func compareImages(img1 image.Image, img2 image.Image) (equal bool) {
+	return compareImagesTolerance(img1, img2, 0)
+}
+
+// compareImagesTolerance compares two images pixel by pixel. Images must be of
+// same size and no color component may differ by more than tol (0-255) in
+// order for function to return true.
+func compareImagesTolerance(img1 image.Image, img2 image.Image,
+	tol uint32) (equal bool) {
 
 	// Make sure dimensions are equal.
 	if img1.Bounds().Dx() != img2.Bounds().Dx() ||
@@ -461,7 +651,8 @@ func compareImages(img1 image.Image, img2 image.Image) (equal bool) {
 			r1, g1, b1, _ = img1.At(x+sx1, y+sy1).RGBA()
 			r2, g2, b2, _ = img2.At(x+sx2, y+sy2).RGBA()
 
-			if r1 != r2 || g1 != g2 || b1 != b2 {
+			if absDiff(r1, r2) > tol*257 || absDiff(g1, g2) > tol*257 ||
+				absDiff(b1, b2) > tol*257 {
 				return false
 			}
 		}
@@ -521,6 +712,14 @@ func compareImagesMonochrome(img1 image.Image, img2 image.Image) (equal bool) {
 	return true
 }
 
+// loadImage returns the preloaded reference image or loads it from file.
+func (r *reference) loadImage(file string) (image.Image, error) {
+	if r.img != nil {
+		return r.img, nil
+	}
+	return loadImage(file)
+}
+
 // loadImage loads and png image.
 func loadImage(fileName string) (refImg image.Image, err error) {
 
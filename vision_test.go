@@ -86,8 +86,8 @@ func Test_matcher_findSource(t *testing.T) {
 		Refs []reference
 	}
 
-	s1 := source{"source1", nil, nil}
-	s2 := source{"source2", nil, nil}
+	s1 := source{Name: "source1"}
+	s2 := source{Name: "source2"}
 
 	type args struct {
 		srcName string